@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxWorkerCount bounds worker_count on PATCH /api/admin/config.
+const maxWorkerCount = 64
+
+// configMu serializes config updates so two PATCHes can't each apply half
+// of what they read.
+var configMu sync.Mutex
+
+// requireAdmin gates a handler behind ADMIN_TOKEN, sent as a bearer token.
+// Admin endpoints are disabled entirely when no token is configured.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isAdmin(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// isAdmin checks the request's admin token, answering 403 or 401 itself
+// when it doesn't pass.
+func isAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminToken == "" {
+		jsonError(w, "Admin API disabled: set ADMIN_TOKEN", http.StatusForbidden)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		jsonError(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	changes, err := reloadRegistry()
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Reload rejected, keeping current config: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("Admin%s: Reloaded %s %v\n", reqTag(requestID(r.Context())), modelsConfigPath, changes)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Config reloaded",
+		"changes": changes,
+	})
+}
+
+// redactURL hides a URL's password, and the whole value if it doesn't
+// parse, so a config dump never shows credentials.
+func redactURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[redacted]"
+	}
+	return u.Redacted()
+}
+
+// secretState says whether a secret is configured without revealing it.
+func secretState(v string) string {
+	if v == "" {
+		return "unset"
+	}
+	return "[redacted]"
+}
+
+// liveConfig is the effective runtime configuration for GET
+// /api/admin/config. Secrets are redacted.
+func liveConfig() map[string]interface{} {
+	workers, paused, aging, queued, running := queue.settings()
+	mode := "runware"
+	if useMock {
+		mode = "mock"
+	}
+	return map[string]interface{}{
+		"provider": map[string]interface{}{
+			"mode":                mode,
+			"runware_api_url":     redactURL(runwareAPIURL),
+			"runware_regions":     redactedRegions(),
+			"runware_api_key":     secretState(runwareAPIKey),
+			"allow_mock_override": allowMockOverride,
+		},
+		"model_runner": map[string]interface{}{
+			"url":                redactURL(modelRunnerURL),
+			"model":              modelRunnerModel,
+			"prompt_models":      promptModels,
+			"keepalive_interval": modelRunnerKeepalive.String(),
+			"warmup":             modelRunnerWarmup,
+		},
+		"limits": map[string]interface{}{
+			"max_upload_video_mb":     maxUploadVideoMB,
+			"max_video_mb":            maxVideoMB,
+			"max_inline_mb":           maxInlineMB,
+			"max_videos_disk_mb":      maxVideosDiskMB,
+			"body_limits":             bodyLimits,
+			"default_body_limit":      defaultBodyLimit,
+			"video_download_timeout":  videoDownloadTimeout.String(),
+			"download_retries":        downloadRetries,
+			"max_status_wait":         maxStatusWait.String(),
+			"max_generate_wait":       maxGenerateWait.String(),
+			"auto_prompt_max_images":  autoPromptMaxImages,
+			"auto_prompt_max_edge":    autoPromptMaxEdge,
+			"auto_prompt_quality":     autoPromptJPEGQuality,
+			"auto_prompt_progressive": autoPromptProgressive,
+			"auto_prompt_subsampling": autoPromptSubsampling,
+			"upload_max_edge":         uploadMaxEdge,
+			"upload_max_pixels":       uploadMaxPixels,
+			"upload_grace_period":     uploadGracePeriod.String(),
+			"resume_max_age":          resumeMaxAge.String(),
+			"reap_after":              reapAfter.String(),
+			"reap_interval":           reapInterval.String(),
+		},
+		"directories": map[string]interface{}{
+			"jobs_file":      jobsFile,
+			"templates_file": templatesFile,
+			"models_config":  modelsConfigPath,
+			"samples_dir":    samplesDir,
+			"temp_dir":       tempDir,
+		},
+		"features": map[string]interface{}{
+			"store_videos_locally":   storeVideosLocally,
+			"poll_batching":          pollBatching,
+			"video_metadata":         videoMetadata,
+			"upload_keep_original":   uploadKeepOriginal,
+			"sniff_image_types":      sniffImageTypes,
+			"callback_allow_private": callbackAllowPrivate,
+			"broker_url":             redactURL(brokerURL),
+			"bg_removal_url":         redactURL(bgRemovalURL),
+			"admin_token":            secretState(adminToken),
+			"enabled_styles":         enabledStyles,
+		},
+		"queue": map[string]interface{}{
+			"worker_count":   workers,
+			"paused":         paused,
+			"priority_aging": aging.String(),
+			"queued":         queued,
+			"running":        running,
+		},
+	}
+}
+
+func handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveConfig())
+}
+
+// handleAdminUpdateConfig changes the settings that are safe to adjust on
+// a running server. Every field is validated before any is applied, and
+// unknown fields are rejected rather than silently ignored.
+func handleAdminUpdateConfig(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		WorkerCount   *int    `json:"worker_count"`
+		Paused        *bool   `json:"paused"`
+		PriorityAging *string `json:"priority_aging"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			jsonError(w, fmt.Sprintf("%s cannot be changed at runtime; adjustable: worker_count, paused, priority_aging", field), http.StatusBadRequest)
+			return
+		}
+		bodyError(w, err)
+		return
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+
+	workers, paused, aging, _, _ := queue.settings()
+	if req.WorkerCount != nil {
+		if *req.WorkerCount < 1 || *req.WorkerCount > maxWorkerCount {
+			jsonError(w, fmt.Sprintf("worker_count must be 1-%d", maxWorkerCount), http.StatusBadRequest)
+			return
+		}
+		workers = *req.WorkerCount
+	}
+	if req.Paused != nil {
+		paused = *req.Paused
+	}
+	if req.PriorityAging != nil {
+		d, err := time.ParseDuration(*req.PriorityAging)
+		if err != nil || d < time.Second {
+			jsonError(w, "priority_aging must be a duration of at least 1s, e.g. 2m", http.StatusBadRequest)
+			return
+		}
+		aging = d
+	}
+
+	queue.tune(workers, paused, aging)
+	fmt.Printf("Admin%s: Config set: worker_count=%d paused=%v priority_aging=%s\n", reqTag(requestID(r.Context())), workers, paused, aging)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveConfig())
+}
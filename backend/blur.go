@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// blurScale is how far the background is shrunk before being scaled back
+// up; larger is blurrier. 1/24 of the image makes rooms and screens
+// unreadable while keeping their colors.
+const blurScale = 24
+
+// blurPath is where the background-blurred copy of an input image is kept,
+// alongside its cutout.
+func blurPath(src string) string {
+	return strings.TrimSuffix(cutoutPath(src), ".cutout.png") + ".blur.jpg"
+}
+
+// blurBackground returns a JPEG of src with everything but the product
+// blurred, making it on first use and reusing the file afterwards. The
+// product is found from its cutout when BG_REMOVAL_URL is set; otherwise,
+// or when that fails, the center of the frame is kept sharp on the
+// assumption that the product sits there.
+func blurBackground(job *Job, src string) (string, error) {
+	dst := blurPath(src)
+	if _, err := os.Stat(dst); err == nil {
+		return dst, nil
+	}
+
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("decode %s: %v", filepath.Base(src), err)
+	}
+
+	var mask image.Image
+	method := "center"
+	if bgRemovalURL != "" {
+		if p, err := cutout(job, src); err != nil {
+			jobLogf(job, levelWarn, "No cutout for %s (%v), keeping the center sharp", filepath.Base(src), err)
+		} else if m, err := decodeFile(p); err == nil {
+			mask, method = m, "cutout"
+		}
+	}
+	if mask == nil {
+		mask = centerMask(img.Bounds())
+	}
+
+	out := composite(img, blurred(img), mask)
+	err = writeFileAtomic(dst, func(w io.Writer) error {
+		return jpeg.Encode(w, out, &jpeg.Options{Quality: 90})
+	})
+	if err != nil {
+		return "", err
+	}
+	jobLogf(job, levelInfo, "Blurred background of %s (%s mask) → %s", filepath.Base(src), method, filepath.Base(dst))
+	return dst, nil
+}
+
+func decodeFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// blurred is a heavily blurred copy of img, made by shrinking it with a
+// filtering scaler and stretching it back.
+func blurred(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	small := image.NewRGBA(image.Rect(0, 0, max(1, b.Dx()/blurScale), max(1, b.Dy()/blurScale)))
+	xdraw.CatmullRom.Scale(small, small.Bounds(), img, b, xdraw.Src, nil)
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	xdraw.BiLinear.Scale(out, out.Bounds(), small, small.Bounds(), xdraw.Src, nil)
+	return out
+}
+
+// centerMask keeps an ellipse over the middle of the frame, fading out
+// toward the edges so there's no hard seam.
+func centerMask(b image.Rectangle) *image.Alpha {
+	m := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+	rx, ry := float64(b.Dx())*0.35, float64(b.Dy())*0.4
+	cx, cy := float64(b.Dx())/2, float64(b.Dy())/2
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dx, dy := (float64(x)-cx)/rx, (float64(y)-cy)/ry
+			d := math.Sqrt(dx*dx + dy*dy)
+			// Sharp inside 0.8, blurred beyond 1.2
+			a := math.Min(1, math.Max(0, (1.2-d)/0.4))
+			m.SetAlpha(x, y, color.Alpha{A: uint8(a * 255)})
+		}
+	}
+	return m
+}
+
+// composite draws sharp over bg wherever mask is opaque. Masks of another
+// size, like a cutout of a resized image, are stretched to fit.
+func composite(sharp image.Image, bg *image.RGBA, mask image.Image) *image.RGBA {
+	b := sharp.Bounds()
+	if mask.Bounds().Size() != b.Size() {
+		fitted := image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+		xdraw.BiLinear.Scale(fitted, fitted.Bounds(), mask, mask.Bounds(), xdraw.Src, nil)
+		mask = fitted
+	}
+	xdraw.DrawMask(bg, bg.Bounds(), sharp, b.Min, mask, mask.Bounds().Min, xdraw.Over)
+	return bg
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultBodyLimit caps request bodies on every route without an entry in
+// bodyLimits. API requests are small JSON documents.
+const defaultBodyLimit = 1 << 20
+
+// bodyLimits holds the body cap per route path. Frames arrive as base64
+// JSON and uploads as multipart forms, so those need far more than a
+// generate request. 0 leaves the route to enforce its own limit, as
+// /api/upload-video does with MAX_UPLOAD_VIDEO_MB.
+var bodyLimits = map[string]int64{
+	"/api/upload":          25 << 20,
+	"/api/upload-multiple": 200 << 20,
+	"/api/upload-frame":    25 << 20,
+	"/api/upload-video":    0,
+}
+
+// loadBodyLimits applies BODY_LIMITS, e.g.
+// "/api/upload-frame=40MB,/api/generate=256KB", on top of the defaults.
+func loadBodyLimits(spec string) error {
+	for _, entry := range splitList(spec) {
+		path, size, ok := strings.Cut(entry, "=")
+		path = strings.TrimSpace(path)
+		if !ok || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("BODY_LIMITS: %q should look like /api/path=10MB", entry)
+		}
+		n, err := parseSize(strings.TrimSpace(size))
+		if err != nil {
+			return fmt.Errorf("BODY_LIMITS: %s: %v", path, err)
+		}
+		bodyLimits[path] = n
+	}
+	return nil
+}
+
+// parseSize reads a byte count with an optional KB or MB suffix.
+func parseSize(s string) (int64, error) {
+	upper := strings.ToUpper(s)
+	shift := 0
+	switch {
+	case strings.HasSuffix(upper, "MB"):
+		upper, shift = strings.TrimSuffix(upper, "MB"), 20
+	case strings.HasSuffix(upper, "KB"):
+		upper, shift = strings.TrimSuffix(upper, "KB"), 10
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(upper), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// limitBody caps the body of requests to path. Bodies that announce their
+// length are refused up front; streamed ones fail when a read crosses the
+// cap, which handlers report through bodyError.
+func limitBody(path string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := bodyLimits[path]
+		if !ok {
+			limit = defaultBodyLimit
+		}
+		if limit > 0 {
+			if r.ContentLength > limit {
+				jsonError(w, tooLargeMessage(limit), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next(w, r)
+	}
+}
+
+// bodyError answers a request whose body could not be read or decoded:
+// 413 when it ran over the route's limit, 400 otherwise.
+func bodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		jsonError(w, tooLargeMessage(tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	jsonError(w, "Invalid request body", http.StatusBadRequest)
+}
+
+func tooLargeMessage(limit int64) string {
+	if limit >= 1<<20 {
+		return fmt.Sprintf("Request body exceeds %d MB", limit>>20)
+	}
+	return fmt.Sprintf("Request body exceeds %d KB", limit>>10)
+}
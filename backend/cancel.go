@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// newJobContext gives the job the context its provider calls, polling and
+// downloads run under. Called before any worker or poller sees the job.
+func newJobContext(job *Job) {
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+}
+
+// cancelled reports whether the job was cancelled. Stages check it before
+// recording a result so they don't overwrite the cancellation.
+func (j *Job) cancelled() bool { return j.ctx.Err() != nil }
+
+// discardVideos removes every file a cancelled job left in videos/.
+func discardVideos(job *Job) {
+	own, _ := filepath.Glob(filepath.Join("videos", job.ID+".*"))
+	extras, _ := filepath.Glob(filepath.Join("videos", job.ID+"-*.mp4"))
+	for _, p := range append(own, extras...) {
+		os.Remove(p)
+	}
+}
+
+// handleCancelJob stops a queued or running job. A queued job never starts;
+// a running one has its provider poll and any in-progress download aborted,
+// and the partial file is removed. The job ends as failed with
+// error_category "cancelled".
+func handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	jobsMu.Lock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.Unlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if jobFinished(job.Status) {
+		jobsMu.Unlock()
+		jsonError(w, fmt.Sprintf("Job already %s", job.Status), http.StatusConflict)
+		return
+	}
+	job.cancel()
+	job.Status = "failed"
+	job.Error = "Cancelled"
+	job.ErrorCategory = categoryCancelled
+	markFinished(job)
+	jobsMu.Unlock()
+
+	queue.remove(job)
+	jobLogf(job, levelInfo, "Cancelled%s", reqTag(requestID(r.Context())))
+	saveJobs()
+	emitJobEvent(job, eventFailed, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":             job.ID,
+		"status":         "failed",
+		"error":          "Cancelled",
+		"error_category": categoryCancelled,
+	})
+}
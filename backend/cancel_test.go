@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowVideoServer sends the start of an mp4 and then stalls until the
+// client goes away, signalling started once the first bytes are out.
+func slowVideoServer(t *testing.T, started chan<- struct{}, requests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("\x00\x00\x00\x18ftypmp42"))
+		w.(http.Flusher).Flush()
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadWithRetryCancelled(t *testing.T) {
+	oldTemp, oldRetries, oldBackoff := tempDir, downloadRetries, downloadBackoff
+	tempDir, downloadRetries, downloadBackoff = "", 3, time.Millisecond
+	t.Cleanup(func() { tempDir, downloadRetries, downloadBackoff = oldTemp, oldRetries, oldBackoff })
+
+	started := make(chan struct{}, 1)
+	var requests atomic.Int32
+	srv := slowVideoServer(t, started, &requests)
+
+	job := &Job{ID: "cancel-test"}
+	newJobContext(job)
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "video.mp4")
+
+	go func() {
+		<-started
+		job.cancel()
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := downloadWithRetry(job, srv.URL, localPath)
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("download did not stop after cancel")
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1: a cancelled download must not be retried", n)
+	}
+	if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+		t.Errorf("%s exists after cancel", localPath)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("partial file %s left behind", e.Name())
+	}
+}
+
+func TestDownloadWithRetryCancelledDuringBackoff(t *testing.T) {
+	oldTemp, oldRetries, oldBackoff := tempDir, downloadRetries, downloadBackoff
+	tempDir, downloadRetries, downloadBackoff = "", 3, time.Hour
+	t.Cleanup(func() { tempDir, downloadRetries, downloadBackoff = oldTemp, oldRetries, oldBackoff })
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	job := &Job{ID: "cancel-backoff-test"}
+	newJobContext(job)
+	dir := t.TempDir()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := downloadWithRetry(job, srv.URL, filepath.Join(dir, "video.mp4"))
+		done <- err
+	}()
+	// The first attempt fails at once and the retry waits an hour; the
+	// warning is logged just before the wait starts
+	for retrying := false; !retrying; {
+		time.Sleep(time.Millisecond)
+		jobsMu.RLock()
+		retrying = len(job.logs) > 0
+		jobsMu.RUnlock()
+	}
+	job.cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("backoff did not end on cancel")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+}
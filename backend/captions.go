@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Caption formats a generate request can ask for.
+const (
+	captionsSRT  = "srt"  // .srt sidecar next to the video
+	captionsBurn = "burn" // burned into the video, sidecar kept as well
+)
+
+var validCaptions = map[string]bool{"": true, captionsSRT: true, captionsBurn: true}
+
+type caption struct {
+	Text  string  `json:"text"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// addCaptions writes <id>.srt next to the downloaded video and, for burned
+// captions, re-encodes the video with them. It returns the sidecar's URL,
+// which stays usable even when burning fails.
+func addCaptions(job *Job, videoPath string) (string, error) {
+	caps, err := captionsFromModel(job)
+	if err != nil {
+		jobLogf(job, levelWarn, "Caption model failed (%v), splitting the script instead", err)
+		caps = splitCaptions(captionScript(job), job.Duration)
+	}
+	if len(caps) == 0 {
+		return "", errors.New("no caption text")
+	}
+
+	srtPath := filepath.Join("videos", job.ID+".srt")
+	err = writeFileAtomic(srtPath, func(w io.Writer) error {
+		_, err := io.WriteString(w, formatSRT(caps))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	srtURL := fmt.Sprintf("http://localhost:8080/videos/%s.srt", job.ID)
+	if job.Captions == captionsBurn {
+		if err := burnCaptions(job.ctx, videoPath, srtPath); err != nil {
+			return srtURL, err
+		}
+	}
+	return srtURL, nil
+}
+
+// captionScript is the text captions are written from: the narration when
+// there is one, otherwise the generation prompt.
+func captionScript(job *Job) string {
+	if job.narration != "" {
+		return job.narration
+	}
+	return job.Prompt
+}
+
+var (
+	jsonArrayPattern = regexp.MustCompile(`(?s)\[.*\]`)
+	sentencePattern  = regexp.MustCompile(`[.!?]+\s*`)
+)
+
+// captionsFromModel asks the Model Runner for short on-screen lines timed
+// to the video.
+func captionsFromModel(job *Job) ([]caption, error) {
+	instructions := fmt.Sprintf(
+		"Write on-screen captions for a %d-second product ad. "+
+			"Script: %q. "+
+			"Use 2-4 short lines of at most 6 words each, timed to cover the whole video without overlapping. "+
+			"Reply with ONLY a JSON array like "+
+			`[{"text": "Meet the new mug", "start": 0, "end": 2}]`+".",
+		job.Duration, captionScript(job),
+	)
+	reply, _, err := askModelRunner(modelRunnerModel, []map[string]interface{}{
+		{"type": "text", "text": instructions},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Models like to wrap JSON in prose or code fences
+	raw := jsonArrayPattern.FindString(reply)
+	if raw == "" {
+		return nil, fmt.Errorf("no JSON array in reply %q", reply)
+	}
+	var caps []caption
+	if err := json.Unmarshal([]byte(raw), &caps); err != nil {
+		return nil, err
+	}
+	return clampCaptions(caps, float64(job.Duration)), nil
+}
+
+// clampCaptions drops empty lines and keeps timings inside the video.
+func clampCaptions(caps []caption, duration float64) []caption {
+	var out []caption
+	for _, c := range caps {
+		c.Text = strings.TrimSpace(c.Text)
+		if c.Start < 0 {
+			c.Start = 0
+		}
+		if c.End > duration {
+			c.End = duration
+		}
+		if c.Text == "" || c.End <= c.Start {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// splitCaptions spreads the script's sentences evenly over the video.
+func splitCaptions(script string, duration int) []caption {
+	var lines []string
+	for _, s := range sentencePattern.Split(script, -1) {
+		if s = strings.TrimSpace(s); s != "" {
+			lines = append(lines, s)
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	step := float64(duration) / float64(len(lines))
+	caps := make([]caption, len(lines))
+	for i, line := range lines {
+		caps[i] = caption{Text: line, Start: float64(i) * step, End: float64(i+1) * step}
+	}
+	return caps
+}
+
+func formatSRT(caps []caption) string {
+	var b strings.Builder
+	for i, c := range caps {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(c.Start), srtTime(c.End), c.Text)
+	}
+	return b.String()
+}
+
+// srtTime formats seconds as HH:MM:SS,mmm.
+func srtTime(sec float64) string {
+	ms := int(sec*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// burnCaptions re-encodes videoPath with the subtitles drawn in, styled by
+// captionStyle, and swaps it in place once ffmpeg succeeds. Cancelling ctx
+// stops ffmpeg.
+func burnCaptions(ctx context.Context, videoPath, srtPath string) error {
+	f, err := createTemp(videoPath)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	tmp := f.Name()
+
+	filter := fmt.Sprintf("subtitles=%s:force_style='%s'", srtPath, captionStyle)
+	out, err := exec.CommandContext(ctx, ffmpegPath, "-y", "-v", "error",
+		"-i", videoPath,
+		"-vf", filter,
+		"-c:a", "copy",
+		tmp,
+	).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return commitTemp(tmp, videoPath)
+}
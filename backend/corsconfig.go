@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/cors"
+)
+
+// Headers every browser client needs; CORS_HEADERS adds to these.
+var baseCORSHeaders = []string{"Content-Type", "If-None-Match", "Authorization", "X-Request-ID", "X-App-Version"}
+
+var (
+	knownMethods = map[string]bool{
+		"GET": true, "HEAD": true, "POST": true, "PUT": true,
+		"PATCH": true, "DELETE": true, "OPTIONS": true,
+	}
+	headerToken = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+)
+
+// routeMux is an http.ServeMux that remembers the methods its patterns
+// use, so CORS always allows whatever the API actually serves. It also caps
+// each route's request body; see bodylimit.go.
+type routeMux struct {
+	*http.ServeMux
+	methods map[string]bool
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux(), methods: map[string]bool{"OPTIONS": true}}
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if ok {
+		m.methods[method] = true
+	} else {
+		path = pattern
+	}
+	m.ServeMux.HandleFunc(pattern, limitBody(path, handler))
+}
+
+// corsOptions combines the routed methods and base headers with
+// CORS_METHODS and CORS_HEADERS, rejecting anything malformed.
+func corsOptions(mux *routeMux) (cors.Options, error) {
+	methods := make(map[string]bool)
+	for m := range mux.methods {
+		methods[m] = true
+	}
+	for _, m := range splitList(corsMethods) {
+		m = strings.ToUpper(m)
+		if !knownMethods[m] {
+			return cors.Options{}, fmt.Errorf("CORS_METHODS: unknown method %q", m)
+		}
+		methods[m] = true
+	}
+
+	headers := append([]string{}, baseCORSHeaders...)
+	for _, h := range splitList(corsHeaders) {
+		if !headerToken.MatchString(h) {
+			return cors.Options{}, fmt.Errorf("CORS_HEADERS: invalid header name %q", h)
+		}
+		headers = append(headers, h)
+	}
+
+	allowed := make([]string, 0, len(methods))
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+
+	return cors.Options{
+		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowedMethods:   allowed,
+		AllowedHeaders:   headers,
+		ExposedHeaders:   []string{"ETag", "X-Request-ID"},
+		AllowCredentials: true,
+	}, nil
+}
+
+// splitList splits a comma-separated env value, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
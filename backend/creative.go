@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// creativeOption is one structured creative control and the prompt phrase
+// it stands for.
+type creativeOption struct {
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Prompt string `json:"prompt"`
+}
+
+var (
+	cameraMoves = []creativeOption{
+		{"orbit", "Orbit", "Slow orbit around the product."},
+		{"dolly", "Dolly in", "Smooth dolly in toward the product."},
+		{"static", "Static", "Locked-off static camera, the product stays centered."},
+		{"zoom", "Zoom", "Gradual zoom in on the product details."},
+	}
+	lightingPresets = []creativeOption{
+		{"studio", "Studio", "Clean studio lighting with soft shadows."},
+		{"golden-hour", "Golden hour", "Warm golden-hour sunlight with long soft shadows."},
+		{"dramatic", "Dramatic", "Dramatic low-key lighting with strong rim light."},
+	}
+	moods = []creativeOption{
+		{"premium", "Premium", "Premium, elegant feel."},
+		{"playful", "Playful", "Playful, upbeat feel."},
+		{"calm", "Calm", "Calm, minimal feel."},
+		{"energetic", "Energetic", "Energetic, bold feel."},
+	}
+)
+
+// CreativeChoice is the structured direction a job was generated with.
+type CreativeChoice struct {
+	Camera   string `json:"camera,omitempty"`
+	Lighting string `json:"lighting,omitempty"`
+	Mood     string `json:"mood,omitempty"`
+}
+
+// direction validates the choice and assembles its phrases, always in
+// camera, lighting, mood order so the same choice gives the same prompt.
+func (c CreativeChoice) direction() (string, error) {
+	var parts []string
+	for _, f := range []struct {
+		field, value string
+		options      []creativeOption
+	}{
+		{"camera", c.Camera, cameraMoves},
+		{"lighting", c.Lighting, lightingPresets},
+		{"mood", c.Mood, moods},
+	} {
+		if f.value == "" {
+			continue
+		}
+		opt, ok := findOption(f.options, f.value)
+		if !ok {
+			ids := make([]string, len(f.options))
+			for i, o := range f.options {
+				ids[i] = o.ID
+			}
+			return "", fmt.Errorf("%s must be one of: %s", f.field, strings.Join(ids, ", "))
+		}
+		parts = append(parts, opt.Prompt)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// creativePrompt appends the structured direction to the usual prompt.
+// With neither a style nor a prompt, the generic fallback's own camera and
+// lighting would contradict it, so only the product is kept from that.
+func creativePrompt(style *StyleConfig, userPrompt, productName, direction string) string {
+	if style == nil && userPrompt == "" {
+		product := "a product"
+		if productName != "" {
+			product = productName
+		}
+		return fmt.Sprintf("Commercial advertisement for %s. %s Sharp focus.", product, direction)
+	}
+	return buildPrompt(style, userPrompt, productName) + " " + direction
+}
+
+func findOption(options []creativeOption, id string) (creativeOption, bool) {
+	for _, o := range options {
+		if o.ID == id {
+			return o, true
+		}
+	}
+	return creativeOption{}, false
+}
+
+// handleCreativeOptions lists the values /api/generate accepts for camera,
+// lighting and mood.
+func handleCreativeOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"camera":   cameraMoves,
+		"lighting": lightingPresets,
+		"mood":     moods,
+	})
+}
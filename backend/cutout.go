@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cutoutPath is where the background-removed copy of an input image is
+// kept: next to the upload, or in uploads/ for bundled samples so
+// SAMPLES_DIR stays read-only.
+func cutoutPath(src string) string {
+	name := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src)) + ".cutout.png"
+	dir := filepath.Dir(src)
+	if dir != "uploads" && !strings.HasPrefix(dir, "uploads"+string(filepath.Separator)) {
+		return filepath.Join("uploads", "sample-"+name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// cutout returns a PNG of src with its background removed, asking the
+// BG_REMOVAL_URL service on first use and reusing the file afterwards.
+// The service receives the image bytes as the request body and must answer
+// with a PNG.
+func cutout(job *Job, src string) (string, error) {
+	dst := cutoutPath(src)
+	if _, err := os.Stat(dst); err == nil {
+		return dst, nil
+	}
+	if bgRemovalURL == "" {
+		return "", fmt.Errorf("BG_REMOVAL_URL is not set")
+	}
+
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: bgRemovalTimeout}
+	resp, err := client.Post(bgRemovalURL, imageMediaType(src, data), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("background removal returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 50<<20))
+	if err != nil {
+		return "", err
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("background removal did not return a PNG: %v", err)
+	}
+	if b, ok := sourceBounds(data); ok && img.Bounds().Size() != b.Size() {
+		return "", fmt.Errorf("cutout is %v but the source is %v", img.Bounds().Size(), b.Size())
+	}
+
+	err = writeFileAtomic(dst, func(w io.Writer) error {
+		_, err := w.Write(body)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	jobLogf(job, levelInfo, "Removed background from %s → %s", filepath.Base(src), filepath.Base(dst))
+	return dst, nil
+}
+
+// sourceBounds decodes just the header of an image to learn its size.
+func sourceBounds(data []byte) (image.Rectangle, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return image.Rectangle{}, false
+	}
+	return image.Rect(0, 0, cfg.Width, cfg.Height), true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Bounds for the per-job provider transcript kept for /debug.
+const (
+	maxDebugExchanges = 20
+	maxDebugBodyBytes = 8 << 10
+)
+
+var base64DataURL = regexp.MustCompile(`data:([a-z]+/[a-z0-9.+-]+);base64,[A-Za-z0-9+/=]+`)
+
+type debugExchange struct {
+	Kind   string `json:"kind"` // "generate" or "poll"
+	Status int    `json:"status"`
+	Body   string `json:"body"`
+	At     string `json:"at"`
+}
+
+// redactBase64 replaces inline base64 media with a short placeholder.
+func redactBase64(body []byte) string {
+	return base64DataURL.ReplaceAllStringFunc(string(body), func(m string) string {
+		mediaType := base64DataURL.FindStringSubmatch(m)[1]
+		return fmt.Sprintf("data:%s;base64,<redacted %d bytes>", mediaType, len(m))
+	})
+}
+
+func truncateBody(body string) string {
+	if len(body) > maxDebugBodyBytes {
+		return body[:maxDebugBodyBytes] + "…(truncated)"
+	}
+	return body
+}
+
+func recordDebugRequest(job *Job, reqBody []byte) {
+	jobsMu.Lock()
+	job.debugRequest = truncateBody(redactBase64(reqBody))
+	jobsMu.Unlock()
+}
+
+// recordDebugResponse appends a provider response, keeping the first one
+// (the generate reply) and the most recent polls once the cap is reached.
+func recordDebugResponse(job *Job, kind string, status int, body []byte) {
+	ex := debugExchange{
+		Kind:   kind,
+		Status: status,
+		Body:   truncateBody(string(body)),
+		At:     timestamp(),
+	}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	job.debugResponses = append(job.debugResponses, ex)
+	if len(job.debugResponses) > maxDebugExchanges {
+		job.debugResponses = append(job.debugResponses[:1], job.debugResponses[2:]...)
+	}
+}
+
+func handleJobDebug(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	jobsMu.RLock()
+	job, exists := jobs[id]
+	var resp map[string]interface{}
+	if exists {
+		var request interface{} = job.debugRequest
+		var parsed interface{}
+		if json.Unmarshal([]byte(job.debugRequest), &parsed) == nil {
+			request = parsed
+		}
+		resp = map[string]interface{}{
+			"id":          job.ID,
+			"status":      job.Status,
+			"request_id":  job.RequestID,
+			"app_version": job.AppVersion,
+			"request":     request,
+			"responses":   append([]debugExchange(nil), job.debugResponses...),
+		}
+	}
+	jobsMu.RUnlock()
+
+	if !exists {
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// statusEvicted marks a completed job whose local files were removed to
+// stay within MAX_VIDEOS_DISK_MB. Its video_url falls back to the
+// provider's URL when there is one.
+const statusEvicted = "video_evicted"
+
+// budgetMu keeps concurrent completions from evicting on top of each other.
+var budgetMu sync.Mutex
+
+// makeVideoRoom evicts the oldest completed jobs' videos until videos/ fits
+// in MAX_VIDEOS_DISK_MB again. The job that just finished is never evicted,
+// even if it alone is over budget. It's a no-op when no budget is set or
+// videos aren't stored locally.
+func makeVideoRoom(current *Job) {
+	if maxVideosDiskMB <= 0 || !storeVideosLocally {
+		return
+	}
+	budgetMu.Lock()
+	defer budgetMu.Unlock()
+
+	budget := maxVideosDiskMB << 20
+	used := videosDiskUsage()
+	if used <= budget {
+		return
+	}
+
+	jobsMu.RLock()
+	var candidates []*Job
+	for _, j := range jobs {
+		if j != current && j.Status == "completed" && strings.HasPrefix(j.VideoURL, "http://localhost:8080/videos/") {
+			candidates = append(candidates, j)
+		}
+	}
+	jobsMu.RUnlock()
+	sort.Slice(candidates, func(a, b int) bool { return candidates[a].CompletedAt < candidates[b].CompletedAt })
+
+	evicted := 0
+	for _, j := range candidates {
+		if used <= budget {
+			break
+		}
+		used -= evictVideo(j)
+		evicted++
+	}
+	if evicted > 0 {
+		fmt.Printf("Videos: Evicted %d job(s) to stay within %d MB\n", evicted, maxVideosDiskMB)
+		saveJobs()
+	}
+	if used > budget {
+		jobLogf(current, levelWarn, "videos/ is still %d MB over MAX_VIDEOS_DISK_MB", (used-budget)>>20)
+	}
+}
+
+// evictVideo deletes every file the job has in videos/, points it at the
+// provider's URL if known and returns the bytes freed.
+func evictVideo(j *Job) int64 {
+	var freed int64
+	extras, _ := filepath.Glob(filepath.Join("videos", j.ID+"-*.mp4"))
+	own, _ := filepath.Glob(filepath.Join("videos", j.ID+".*"))
+	for _, p := range append(own, extras...) {
+		if isThumbnailFile(j, p) {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if os.Remove(p) == nil {
+			freed += info.Size()
+		}
+	}
+
+	jobsMu.Lock()
+	j.Status = statusEvicted
+	j.VideoURL = j.RemoteVideoURL
+	j.VideoURLs = nil
+	if j.RemoteVideoURL != "" {
+		j.VideoURLs = []string{j.RemoteVideoURL}
+	}
+	j.CaptionsURL = ""
+	j.OutputURL = ""
+	jobsMu.Unlock()
+	jobLogf(j, levelInfo, "Evicted local video (%d KB)", freed>>10)
+	emitJobEvent(j, eventEvicted, nil)
+	return freed
+}
+
+// videosDiskUsage sums the size of every finished file in videos/.
+func videosDiskUsage() int64 {
+	var total int64
+	entries, _ := os.ReadDir("videos")
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), tempPrefix) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+var errVideoTooLarge = errors.New("video exceeds size limit")
+
+// downloadVideo saves remoteURL to localPath, enforcing videoDownloadTimeout
+// and maxVideoMB. Cancelling ctx aborts the transfer. Nothing is left behind
+// on any failure, including when the result doesn't look like an mp4.
+func downloadVideo(ctx context.Context, remoteURL, localPath string) (int64, error) {
+	client := &http.Client{Timeout: videoDownloadTimeout}
+	req, err := http.NewRequestWithContext(ctx, "GET", remoteURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download returned %d", resp.StatusCode)
+	}
+
+	maxBytes := maxVideoMB << 20
+	if resp.ContentLength > maxBytes {
+		return 0, errVideoTooLarge
+	}
+
+	// Written to a temp file so /videos/ never serves a partial download
+	out, err := createTemp(localPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Read one byte past the cap so an oversized body is detected
+	written, err := io.Copy(out, io.LimitReader(resp.Body, maxBytes+1))
+	out.Close()
+	if err == nil && written > maxBytes {
+		err = errVideoTooLarge
+	}
+	if err == nil {
+		err = checkMP4(out.Name())
+	}
+	if err == nil {
+		err = commitTemp(out.Name(), localPath)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return 0, err
+	}
+	return written, nil
+}
+
+// checkMP4 verifies the file is non-empty and starts with an ftyp box.
+func checkMP4(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(f, head)
+	if n == 0 {
+		return errors.New("downloaded video is empty")
+	}
+	if n < 8 || string(head[4:8]) != "ftyp" {
+		return errors.New("downloaded file is not a valid mp4")
+	}
+	return nil
+}
+
+// downloadWithRetry calls downloadVideo up to downloadRetries more times on
+// failure, doubling the wait between attempts. An oversized video is not
+// retried, and nothing is once the job is cancelled.
+func downloadWithRetry(job *Job, remoteURL, localPath string) (int64, error) {
+	ctx := job.ctx
+	backoff := downloadBackoff
+	for attempt := 0; ; attempt++ {
+		written, err := downloadVideo(ctx, remoteURL, localPath)
+		if err == nil || errors.Is(err, errVideoTooLarge) || ctx.Err() != nil || attempt >= downloadRetries {
+			return written, err
+		}
+		jobLogf(job, levelWarn, "Download attempt %d failed: %v, retrying in %s", attempt+1, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// remoteReachable reports whether url still serves something, so a dead
+// provider link isn't handed to the user as the fallback.
+func remoteReachable(url string) bool {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Head(url)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 400 {
+			return true
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusForbidden {
+			return false
+		}
+	}
+
+	// Some CDNs reject HEAD; ask for the first byte instead
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err = client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < 400
+}
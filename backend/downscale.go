@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	uploadMaxEdge      int
+	uploadMaxPixels    int
+	uploadKeepOriginal bool
+)
+
+// imageTooLargeError is an image with more pixels than UPLOAD_MAX_PIXELS.
+// Its header is enough to tell, so it is refused before being decoded.
+type imageTooLargeError struct{ width, height int }
+
+func (e imageTooLargeError) Error() string {
+	return fmt.Sprintf("Image is %dx%d pixels, over the limit of %d pixels", e.width, e.height, uploadMaxPixels)
+}
+
+// checkPixels refuses an image whose header claims more than
+// UPLOAD_MAX_PIXELS, before decoding it allocates memory for every pixel.
+func checkPixels(cfg image.Config) error {
+	if uploadMaxPixels > 0 && cfg.Width*cfg.Height > uploadMaxPixels {
+		return imageTooLargeError{cfg.Width, cfg.Height}
+	}
+	return nil
+}
+
+// storedImage is what ingestImage made of an upload.
+type storedImage struct {
+	path     string
+	width    int
+	height   int
+	original string // full-size copy, when UPLOAD_KEEP_ORIGINAL kept one
+}
+
+// originalExts are the extensions a kept original can have.
+var originalExts = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// originalPath is where the full-size copy of a downscaled upload is kept,
+// next to it. ext is the original's own extension, which differs from the
+// stored file's for a WEBP stored as JPEG.
+func originalPath(src, ext string) string {
+	return strings.TrimSuffix(src, filepath.Ext(src)) + ".orig" + ext
+}
+
+// ingestImage shrinks a freshly saved upload in place so its longer side is
+// at most UPLOAD_MAX_EDGE, keeping its aspect ratio, and reports the
+// dimensions it ends up with. JPEGs are rotated upright first, since
+// re-encoding drops the EXIF orientation. Go can't write WEBP, so a WEBP
+// that needs shrinking is stored as JPEG under a new path. Images within
+// the limit, or any image with UPLOAD_MAX_EDGE=0, are left as they are.
+// Images over UPLOAD_MAX_PIXELS fail with imageTooLargeError.
+func ingestImage(path string) (storedImage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return storedImage{}, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return storedImage{}, err
+	}
+	if err := checkPixels(cfg); err != nil {
+		return storedImage{}, err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	w, h := cfg.Width, cfg.Height
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	if uploadMaxEdge <= 0 || (w <= uploadMaxEdge && h <= uploadMaxEdge) {
+		return storedImage{path: path, width: w, height: h}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return storedImage{}, err
+	}
+	img = shrinkToEdge(orient(img, orientation), uploadMaxEdge)
+
+	dst := path
+	if format == "webp" {
+		dst = strings.TrimSuffix(path, filepath.Ext(path)) + ".jpg"
+	}
+	encode := func(w io.Writer) error {
+		if format == "png" {
+			return png.Encode(w, img)
+		}
+		return jpeg.Encode(w, flatten(img, color.White), &jpeg.Options{Quality: 90})
+	}
+
+	stored := storedImage{path: dst, width: img.Bounds().Dx(), height: img.Bounds().Dy()}
+	if uploadKeepOriginal {
+		stored.original = originalPath(dst, filepath.Ext(path))
+		if err := os.Rename(path, stored.original); err != nil {
+			return storedImage{}, err
+		}
+	}
+	if err := writeFileAtomic(dst, encode); err != nil {
+		if stored.original != "" {
+			os.Rename(stored.original, path)
+		}
+		return storedImage{}, err
+	}
+	if dst != path && stored.original == "" {
+		os.Remove(path)
+	}
+	return stored, nil
+}
+
+// ingestUpload runs ingestImage for an upload handler. An image Go can't
+// decode is kept as it was uploaded, without dimensions; only failures to
+// write and images over UPLOAD_MAX_PIXELS are returned.
+func ingestUpload(r *http.Request, path string) (storedImage, error) {
+	stored, err := ingestImage(path)
+	if err == nil {
+		return stored, nil
+	}
+	var tooLarge imageTooLargeError
+	if isStorageError(err) || errors.As(err, &tooLarge) {
+		return storedImage{}, err
+	}
+	fmt.Printf("Upload%s: Keeping %s as uploaded: %v\n", reqTag(requestID(r.Context())), filepath.Base(path), err)
+	return storedImage{path: path}, nil
+}
+
+// uploadFields describes a stored upload in an upload response.
+func uploadFields(project string, stored storedImage) map[string]interface{} {
+	name := uploadName(project, filepath.Base(stored.path))
+	fields := map[string]interface{}{
+		"filename":  name,
+		"image_url": fmt.Sprintf("http://localhost:8080/uploads/%s", name),
+	}
+	if stored.width > 0 {
+		fields["width"] = stored.width
+		fields["height"] = stored.height
+	}
+	if stored.original != "" {
+		fields["original_url"] = fmt.Sprintf("http://localhost:8080/uploads/%s", uploadName(project, filepath.Base(stored.original)))
+	}
+	return fields
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) of a JPEG, or 1 if
+// it has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			// Start of scan: the metadata segments are behind us
+			return 1
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for e := ifd + 2; e+12 <= len(tiff) && n > 0; e, n = e+12, n-1 {
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// orient turns img upright according to an EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ow, oh := w, h
+	if orientation >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // upside down, mirrored
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to view
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to view
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
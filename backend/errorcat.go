@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Categories of a failed job, so a client can pick the right remedy: edit
+// the prompt or images, retry later, or top up the account.
+const (
+	categoryContentPolicy  = "content_policy"
+	categoryInvalidInput   = "invalid_input"
+	categoryProviderOutage = "provider_outage"
+	categoryQuota          = "quota"
+	categoryCancelled      = "cancelled"
+)
+
+// categoryHints are matched against the lowercased code, type and message
+// of a Runware error, in order: a moderation message that also says
+// "invalid" is still a policy rejection.
+var categoryHints = []struct {
+	category string
+	hints    []string
+}{
+	{categoryContentPolicy, []string{"moderation", "nsfw", "policy", "safety", "inappropriate", "prohibited", "flagged", "sensitive"}},
+	{categoryQuota, []string{"credit", "balance", "quota", "ratelimit", "rate limit", "too many requests", "insufficient funds", "payment"}},
+	{categoryProviderOutage, []string{"timeout", "timed out", "unavailable", "overloaded", "server error", "internal error", "try again", "maintenance", "capacity"}},
+	{categoryInvalidInput, []string{"invalid", "unsupported", "not supported", "must be", "required", "missing", "too large", "too small", "dimension", "exceed", "format"}},
+}
+
+// categorizeError maps a Runware error to a category, or "" when nothing
+// in it is recognized.
+func categorizeError(e map[string]interface{}) string {
+	var parts []string
+	for _, key := range []string{"code", "type", "message"} {
+		if s, ok := e[key].(string); ok {
+			parts = append(parts, strings.ToLower(s))
+		}
+	}
+	text := strings.Join(parts, " ")
+	for _, c := range categoryHints {
+		for _, hint := range c.hints {
+			if strings.Contains(text, hint) {
+				return c.category
+			}
+		}
+	}
+	return ""
+}
+
+// responseCategory categorizes a non-200 reply to a Runware call by the
+// errors in its body, falling back to what the HTTP status implies.
+func responseCategory(status int, body []byte) string {
+	var resp struct {
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) == nil {
+		for _, e := range resp.Errors {
+			if c := categorizeError(e); c != "" {
+				return c
+			}
+		}
+	}
+	switch {
+	case status == http.StatusPaymentRequired || status == http.StatusTooManyRequests:
+		return categoryQuota
+	case status >= 500:
+		return categoryProviderOutage
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return categoryInvalidInput
+	}
+	return ""
+}
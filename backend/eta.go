@@ -0,0 +1,47 @@
+package main
+
+import "sort"
+
+const (
+	// etaSamples is how many recent renders of a model feed its estimate.
+	etaSamples = 20
+	// fallbackGenerationSeconds covers models with neither history nor a
+	// typical_seconds in the registry.
+	fallbackGenerationSeconds = 90
+)
+
+// estimateSeconds predicts how long one render on model takes: the median
+// of its most recent real (non-mock) renders, or the registry's
+// typical_seconds until it has any. The second value says which was used.
+func estimateSeconds(model *ModelConfig) (int, string) {
+	type sample struct {
+		at      string
+		seconds int
+	}
+	var history []sample
+	jobsMu.RLock()
+	for _, j := range jobs {
+		if j.Model == model.Name && !j.Mock && j.CompletedAt != "" && j.Error == "" && j.GenerationSeconds > 0 {
+			history = append(history, sample{j.CompletedAt, j.GenerationSeconds})
+		}
+	}
+	jobsMu.RUnlock()
+
+	if len(history) == 0 {
+		if model.TypicalSeconds > 0 {
+			return model.TypicalSeconds, "default"
+		}
+		return fallbackGenerationSeconds, "default"
+	}
+
+	sort.Slice(history, func(a, b int) bool { return history[a].at > history[b].at })
+	if len(history) > etaSamples {
+		history = history[:etaSamples]
+	}
+	secs := make([]int, len(history))
+	for i, s := range history {
+		secs[i] = s.seconds
+	}
+	sort.Ints(secs)
+	return secs[len(secs)/2], "history"
+}
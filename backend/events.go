@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Job lifecycle events published to the message broker.
+const (
+	eventCreated   = "created"
+	eventStarted   = "started"
+	eventProgress  = "progress"
+	eventCompleted = "completed"
+	eventFailed    = "failed"
+	eventEvicted   = "evicted"
+)
+
+// publisher sends a payload to a broker subject/channel.
+type publisher interface {
+	publish(subject string, payload []byte) error
+}
+
+type brokerEvent struct {
+	subject string
+	payload []byte
+}
+
+var (
+	broker       publisher
+	brokerEvents = make(chan brokerEvent, 256)
+)
+
+// startBroker connects the configured broker (nats:// or redis://) and
+// starts the publishing goroutine. Without BROKER_URL events are a no-op.
+func startBroker() error {
+	if brokerURL == "" {
+		return nil
+	}
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid BROKER_URL: %v", err)
+	}
+
+	switch u.Scheme {
+	case "nats":
+		broker = &natsPublisher{addr: u.Host}
+	case "redis":
+		password, _ := u.User.Password()
+		broker = &redisPublisher{addr: u.Host, password: password}
+	default:
+		return fmt.Errorf("unsupported BROKER_URL scheme %q (use nats:// or redis://)", u.Scheme)
+	}
+
+	go func() {
+		for ev := range brokerEvents {
+			if err := broker.publish(ev.subject, ev.payload); err != nil {
+				fmt.Printf("Broker: Publish to %s failed: %v\n", ev.subject, err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Long-polling requests waiting on a job, woken by every event for it.
+var (
+	watchersMu sync.Mutex
+	watchers   = make(map[string]map[chan struct{}]bool)
+)
+
+// watchJob returns a channel that is closed on the job's next event and a
+// func that stops watching. Callers must always call the func.
+func watchJob(id string) (<-chan struct{}, func()) {
+	ch := make(chan struct{})
+	watchersMu.Lock()
+	if watchers[id] == nil {
+		watchers[id] = make(map[chan struct{}]bool)
+	}
+	watchers[id][ch] = true
+	watchersMu.Unlock()
+
+	return ch, func() {
+		watchersMu.Lock()
+		defer watchersMu.Unlock()
+		if watchers[id][ch] {
+			delete(watchers[id], ch)
+			if len(watchers[id]) == 0 {
+				delete(watchers, id)
+			}
+		}
+	}
+}
+
+// wakeWatchers closes and forgets every channel watching the job.
+func wakeWatchers(id string) {
+	watchersMu.Lock()
+	for ch := range watchers[id] {
+		close(ch)
+	}
+	delete(watchers, id)
+	watchersMu.Unlock()
+}
+
+// emitJobEvent wakes local watchers and publishes the job's current state
+// under "<BROKER_SUBJECT>.<event>". It never blocks: events are dropped if
+// the broker falls behind.
+func emitJobEvent(job *Job, event string, extra map[string]interface{}) {
+	wakeWatchers(job.ID)
+	if job.callbackURL != "" && (event == eventCompleted || event == eventFailed) {
+		go sendCallback(job, event)
+	}
+	if broker == nil {
+		return
+	}
+
+	jobsMu.RLock()
+	payload, err := json.Marshal(map[string]interface{}{
+		"event": event,
+		"at":    timestamp(),
+		"job":   job,
+		"extra": extra,
+	})
+	jobsMu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	select {
+	case brokerEvents <- brokerEvent{subject: brokerSubject + "." + event, payload: payload}:
+	default:
+		fmt.Printf("Broker: Queue full, dropped %s event for job %s\n", event, job.ID)
+	}
+}
+
+// brokerConn is a lazily (re)connected TCP connection shared by the
+// publishers. Replies are read and discarded by a background reader that
+// can answer server pings.
+type brokerConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (b *brokerConn) write(dial func() (net.Conn, error), data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conn == nil {
+		c, err := dial()
+		if err != nil {
+			return err
+		}
+		b.conn = c
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := b.conn.Write(data); err != nil {
+		b.conn.Close()
+		b.conn = nil
+		return err
+	}
+	return nil
+}
+
+type natsPublisher struct {
+	addr string
+	brokerConn
+}
+
+func (n *natsPublisher) dial() (net.Conn, error) {
+	c, err := net.DialTimeout("tcp", n.addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if line, err := r.ReadString('\n'); err != nil || !strings.HasPrefix(line, "INFO") {
+		c.Close()
+		return nil, fmt.Errorf("unexpected NATS greeting: %q %v", line, err)
+	}
+	c.SetReadDeadline(time.Time{})
+	if _, err := c.Write([]byte("CONNECT {\"verbose\":false,\"pedantic\":false}\r\n")); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if strings.HasPrefix(line, "PING") {
+				n.mu.Lock()
+				c.Write([]byte("PONG\r\n"))
+				n.mu.Unlock()
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (n *natsPublisher) publish(subject string, payload []byte) error {
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(payload), payload)
+	return n.write(n.dial, []byte(msg))
+}
+
+type redisPublisher struct {
+	addr     string
+	password string
+	brokerConn
+}
+
+func (rp *redisPublisher) dial() (net.Conn, error) {
+	c, err := net.DialTimeout("tcp", rp.addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(c)
+	if rp.password != "" {
+		c.Write(respCommand("AUTH", rp.password))
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasPrefix(line, "+OK") {
+			c.Close()
+			return nil, fmt.Errorf("redis AUTH failed: %q %v", strings.TrimSpace(line), err)
+		}
+		c.SetReadDeadline(time.Time{})
+	}
+
+	// Drain PUBLISH replies so the socket buffer never fills
+	go func() {
+		for {
+			if _, err := r.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (rp *redisPublisher) publish(channel string, payload []byte) error {
+	return rp.write(rp.dial, respCommand("PUBLISH", channel, string(payload)))
+}
+
+// respCommand encodes a Redis command as a RESP array of bulk strings.
+func respCommand(args ...string) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return []byte(sb.String())
+}
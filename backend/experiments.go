@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// Experiment and variant names, as set on /api/generate.
+var experimentPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// checkExperiment validates experiment and variant on a generate request.
+// They go together: a variant means nothing without its experiment.
+func checkExperiment(experiment, variant string) error {
+	if experiment == "" && variant == "" {
+		return nil
+	}
+	if experiment == "" || variant == "" {
+		return fmt.Errorf("experiment and variant must be set together")
+	}
+	if !experimentPattern.MatchString(experiment) || !experimentPattern.MatchString(variant) {
+		return fmt.Errorf("experiment and variant must be lowercase letters, digits, - and _ (up to 64)")
+	}
+	return nil
+}
+
+// recordCost keeps what the provider charged for the job's task, from the
+// cost includeCost adds to each result, or the model's listed price when
+// none is reported.
+func recordCost(job *Job, data []map[string]interface{}) {
+	var cost float64
+	reported := false
+	for _, result := range data {
+		if c, ok := result["cost"].(float64); ok {
+			cost += c
+			reported = true
+		}
+	}
+	if !reported && job.model != nil {
+		cost = job.model.costFor(job.Duration)
+	}
+	jobsMu.Lock()
+	job.Cost = math.Round(cost*10000) / 10000
+	jobsMu.Unlock()
+}
+
+// variantStats sums up one variant's jobs.
+type variantStats struct {
+	Variant     string  `json:"variant"`
+	Jobs        int     `json:"jobs"`
+	Completed   int     `json:"completed"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"success_rate"` // completed out of finished; in-flight jobs don't count
+	AvgCost     float64 `json:"avg_cost"`
+	AvgSeconds  float64 `json:"avg_generation_seconds"`
+	ratingStats
+	totalCost    float64
+	costed       int
+	totalSeconds int
+}
+
+// handleExperiment compares the variants of an experiment: how often each
+// completes, and the average cost, generation time and rating of the
+// completed ones.
+func handleExperiment(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	byVariant := map[string]*variantStats{}
+
+	jobsMu.RLock()
+	for _, j := range jobs {
+		if j.Experiment != name {
+			continue
+		}
+		s, ok := byVariant[j.Variant]
+		if !ok {
+			s = &variantStats{Variant: j.Variant}
+			byVariant[j.Variant] = s
+		}
+		s.Jobs++
+		switch j.Status {
+		case "completed", statusEvicted: // an evicted video was still delivered
+			s.Completed++
+			s.totalSeconds += j.GenerationSeconds
+			if j.Cost > 0 {
+				s.totalCost += j.Cost
+				s.costed++
+			}
+			s.add(j)
+		case "failed":
+			s.Failed++
+		}
+	}
+	jobsMu.RUnlock()
+
+	if len(byVariant) == 0 {
+		jsonError(w, "Experiment not found", http.StatusNotFound)
+		return
+	}
+
+	variants := make([]*variantStats, 0, len(byVariant))
+	for _, s := range byVariant {
+		if finished := s.Completed + s.Failed; finished > 0 {
+			s.SuccessRate = round2(float64(s.Completed) / float64(finished))
+		}
+		if s.costed > 0 {
+			s.AvgCost = math.Round(s.totalCost/float64(s.costed)*10000) / 10000
+		}
+		if s.Completed > 0 {
+			s.AvgSeconds = round2(float64(s.totalSeconds) / float64(s.Completed))
+		}
+		s.finish()
+		variants = append(variants, s)
+	}
+	sort.Slice(variants, func(a, b int) bool { return variants[a].Variant < variants[b].Variant })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"experiment": name,
+		"variants":   variants,
+	})
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Summary atomText   `xml:"summary"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// handleJobsFeed renders completed jobs as an Atom feed for feed readers and
+// automation tools. ?project_id= and ?tag= narrow it like the job list.
+func handleJobsFeed(w http.ResponseWriter, r *http.Request) {
+	feedURL := "http://localhost:8080/api/jobs.rss"
+	feed := atomFeed{
+		Title:   "Product Video AI — completed ads",
+		ID:      feedURL,
+		Updated: timestamp(),
+		Links:   []atomLink{{Href: feedURL, Rel: "self"}},
+	}
+
+	jobsMu.RLock()
+	for _, job := range filterJobs(r, listJobs()) {
+		if job.VideoURL == "" || (job.Status != "completed" && job.Status != statusEvicted) {
+			continue
+		}
+		updated := job.CompletedAt
+		if updated == "" {
+			updated = job.CreatedAt
+		}
+		// The enclosure is the delivery copy when the job asked for one
+		video := job.VideoURL
+		if job.OutputURL != "" {
+			video = job.OutputURL
+		}
+		links := []atomLink{
+			{Href: job.VideoURL, Rel: "alternate"},
+			{Href: video, Rel: "enclosure", Type: videoTypeForPath(video)},
+		}
+		if job.ThumbnailURL != "" {
+			links = append(links, atomLink{Href: job.ThumbnailURL, Rel: "enclosure", Type: mediaTypeForPath(job.ThumbnailURL)})
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   job.Model + " — " + job.Ratio,
+			ID:      "urn:job:" + job.ID,
+			Updated: updated,
+			Links:   links,
+			Summary: atomText{Type: "text", Body: job.Prompt},
+		})
+	}
+	jobsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+}
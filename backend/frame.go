@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// handleJobFrame extracts the frame at ?t= seconds from a job's local video
+// and saves it as an upload, to anchor a continuation or use as a
+// thumbnail. The frame lands in the job's project.
+func handleJobFrame(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	t, err := strconv.ParseFloat(r.URL.Query().Get("t"), 64)
+	if err != nil || t < 0 || math.IsInf(t, 0) {
+		jsonError(w, "t must be a timestamp in seconds, e.g. ?t=2.5", http.StatusBadRequest)
+		return
+	}
+
+	jobsMu.RLock()
+	job, ok := jobs[id]
+	if !ok {
+		jobsMu.RUnlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	status, local, project := job.Status, strings.HasPrefix(job.VideoURL, "http://localhost:8080/videos/"), job.Project
+	jobsMu.RUnlock()
+
+	if status != "completed" {
+		jsonError(w, fmt.Sprintf("Job is %s; frames can only be taken from a completed video", status), http.StatusConflict)
+		return
+	}
+	if !local {
+		jsonError(w, "Job has no local video to take a frame from", http.StatusConflict)
+		return
+	}
+	videoPath := filepath.Join("videos", id+".mp4")
+
+	duration, err := probeVideoDuration(r.Context(), videoPath)
+	if err != nil {
+		jobLogf(job, levelWarn, "Probe for frame failed: %v", err)
+		jsonError(w, "Could not read the video's duration", http.StatusInternalServerError)
+		return
+	}
+	if t >= duration {
+		jsonError(w, fmt.Sprintf("t must be less than the video's duration of %.2f seconds", duration), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := uploadDir(project); err != nil {
+		saveFailed(w, r, err, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filename := uploadName(project, uuid.New().String()+".jpg")
+	if err := extractFrame(r.Context(), videoPath, t, filepath.Join("uploads", filename)); err != nil {
+		jobLogf(job, levelWarn, "Frame at %.3fs failed: %v", t, err)
+		saveFailed(w, r, err, "Failed to extract frame", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":   "Frame extracted",
+		"filename":  filename,
+		"image_url": fmt.Sprintf("http://localhost:8080/uploads/%s", filename),
+		"t":         t,
+		"duration":  duration,
+	})
+}
+
+// extractFrame writes the frame of videoPath at t seconds to dst, encoded
+// as dst's extension says with the given ffmpeg output options; with none,
+// a high-quality JPEG. Seeking before the input is fast and frame-accurate
+// with re-encoding. Cancelling ctx stops ffmpeg.
+func extractFrame(ctx context.Context, videoPath string, t float64, dst string, opts ...string) error {
+	f, err := createTemp(dst)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	tmp := f.Name()
+
+	if len(opts) == 0 {
+		opts = []string{"-q:v", "2"}
+	}
+	args := []string{"-y", "-v", "error",
+		"-ss", strconv.FormatFloat(t, 'f', 3, 64),
+		"-i", videoPath,
+		"-frames:v", "1",
+	}
+	args = append(append(args, opts...), tmp)
+	out, err := exec.CommandContext(ctx, ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	// ffmpeg exits cleanly without writing anything past the last frame
+	if info, err := os.Stat(tmp); err != nil || info.Size() == 0 {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg wrote no frame at %.3fs", t)
+	}
+	return commitTemp(tmp, dst)
+}
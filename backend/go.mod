@@ -7,4 +7,4 @@ require (
 	github.com/rs/cors v1.11.1
 )
 
-require golang.org/x/image v0.36.0 // indirect
+require golang.org/x/image v0.36.0
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// groups indexes job IDs by GroupID, in creation order, so a group can be
+// read without scanning every job. Guarded by jobsMu.
+var groups = make(map[string][]string)
+
+// indexGroup records a job under its group. Caller holds jobsMu.
+func indexGroup(job *Job) {
+	if job.GroupID != "" {
+		groups[job.GroupID] = append(groups[job.GroupID], job.ID)
+	}
+}
+
+// sortGroups puts each group back in creation order after loadJobs, which
+// sees jobs in no particular order. Caller holds jobsMu.
+func sortGroups() {
+	for _, ids := range groups {
+		sort.SliceStable(ids, func(i, k int) bool {
+			return jobs[ids[i]].CreatedAt < jobs[ids[k]].CreatedAt
+		})
+	}
+}
+
+// groupStatus sums up a group: "queued" until a job starts, "processing"
+// while any job is unfinished, then "completed" or "failed" when every job
+// ended the same way and "partial" when they didn't.
+func groupStatus(counts map[string]int, total int) string {
+	done := counts["completed"] + counts[statusEvicted]
+	switch {
+	case counts["queued"] == total:
+		return "queued"
+	case counts["queued"]+counts["processing"] > 0:
+		return "processing"
+	case done == total:
+		return "completed"
+	case counts["failed"] == total:
+		return "failed"
+	}
+	return "partial"
+}
+
+// handleGroupStatus returns every job of a generate request that made
+// several, each with its usual status body, so a client can show results
+// as they land with one poll. It answers 304 like /api/status while
+// nothing changed.
+func handleGroupStatus(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("groupId")
+
+	jobsMu.RLock()
+	ids, ok := groups[id]
+	if !ok {
+		jobsMu.RUnlock()
+		jsonError(w, "Group not found", http.StatusNotFound)
+		return
+	}
+	counts := map[string]int{}
+	list := make([]map[string]interface{}, 0, len(ids))
+	for _, jobID := range ids {
+		job := jobs[jobID]
+		counts[job.Status]++
+		list = append(list, statusFields(job))
+	}
+	jobsMu.RUnlock()
+
+	resp := map[string]interface{}{
+		"group_id":  id,
+		"status":    groupStatus(counts, len(ids)),
+		"total":     len(ids),
+		"completed": counts["completed"] + counts[statusEvicted],
+		"failed":    counts["failed"],
+		"pending":   counts["queued"] + counts["processing"],
+		"jobs":      list,
+	}
+
+	body, _ := json.Marshal(resp)
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// heifExts are the upload extensions converted to JPEG on ingest. Go has
+// no HEIF decoder, so conversion runs libheif's heif-convert.
+var heifExts = map[string]bool{".heic": true, ".heif": true}
+
+// heifBrands are the ftyp major brands of HEIF stills, as written by
+// iPhones and most Android cameras.
+var heifBrands = []string{"heic", "heix", "heim", "heis", "mif1", "msf1"}
+
+// errHEIFUnsupported means the server has no heif-convert to decode HEIF.
+var errHEIFUnsupported = errors.New("HEIC/HEIF images aren't supported on this server; export the photo as JPEG and upload it again")
+
+// isHEIF reports whether head starts like a HEIF still image.
+func isHEIF(head []byte) bool {
+	return len(head) >= 12 && string(head[4:8]) == "ftyp" && slices.Contains(heifBrands, string(head[8:12]))
+}
+
+// convertHEIF decodes the HEIF image in src and writes it to dst as a
+// JPEG. Conversion failures come back as heifError so handlers can tell
+// them from storage trouble.
+func convertHEIF(src io.Reader, dst string) error {
+	in, err := createTemp(dst + ".heic")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(in.Name())
+	if _, err := io.Copy(in, src); err != nil {
+		in.Close()
+		return err
+	}
+	if err := in.Close(); err != nil {
+		return err
+	}
+
+	head := make([]byte, 12)
+	if f, err := os.Open(in.Name()); err == nil {
+		io.ReadFull(f, head)
+		f.Close()
+	}
+	if !isHEIF(head) {
+		return heifError{"file is not a HEIC/HEIF image"}
+	}
+
+	out, err := createTemp(dst)
+	if err != nil {
+		return err
+	}
+	out.Close()
+	// heif-convert picks the output format from the extension, which the
+	// temp name keeps from dst
+	tmp := out.Name()
+
+	msg, err := exec.Command(heifConvertPath, "-q", "90", in.Name(), tmp).CombinedOutput()
+	if errors.Is(err, exec.ErrNotFound) {
+		os.Remove(tmp)
+		return errHEIFUnsupported
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return heifError{strings.TrimSpace(string(msg))}
+	}
+	return commitTemp(tmp, dst)
+}
+
+// imageSaveFailed answers a failed image upload: 415 when HEIF can't be
+// converted here, 400 for a HEIF file that doesn't decode or an image over
+// UPLOAD_MAX_PIXELS, and otherwise as saveFailed does with msg.
+func imageSaveFailed(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var he heifError
+	var tooLarge imageTooLargeError
+	switch {
+	case errors.Is(err, errHEIFUnsupported):
+		jsonError(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.As(err, &he):
+		jsonError(w, he.Error(), http.StatusBadRequest)
+	case errors.As(err, &tooLarge):
+		jsonError(w, tooLarge.Error(), http.StatusBadRequest)
+	default:
+		saveFailed(w, r, err, msg, http.StatusInternalServerError)
+	}
+}
+
+// heifError is a HEIF file heif-convert could not decode.
+type heifError struct{ detail string }
+
+func (e heifError) Error() string {
+	return fmt.Sprintf("Could not convert HEIC image to JPEG: %s", e.detail)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"strconv"
+	"strings"
+)
+
+// Frame fit modes for matching input images to the output ratio.
+const (
+	fitNone = "none"
+	fitPad  = "pad"
+	fitCrop = "crop"
+)
+
+var validFits = map[string]bool{fitNone: true, fitPad: true, fitCrop: true}
+
+// backgroundColor parses a background_color such as "#1a1a1a" or "#fff".
+// Empty means white, which letterbox bars and flattened transparency
+// always used before the field existed.
+func backgroundColor(hex string) (color.RGBA, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if h == "" {
+		return color.RGBA{0xff, 0xff, 0xff, 0xff}, nil
+	}
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if len(h) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("background_color must be a hex color like #ffffff, got %q", hex)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xff}, nil
+}
+
+// hexColor is the canonical "#rrggbb" form stored on jobs.
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// flatten composites img onto bg. JPEG has no alpha, and encoding a
+// transparent PNG as-is turns its see-through areas black.
+func flatten(img image.Image, bg color.Color) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(out, out.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(out, out.Bounds(), img, b.Min, draw.Over)
+	return out
+}
+
+// fitToRatio letterboxes (pad) or center-crops (crop) img so its aspect
+// ratio matches width:height. The source is never scaled, so no detail is
+// lost; the provider resizes to the output size.
+func fitToRatio(img image.Image, width, height int, mode string, bg color.Color) image.Image {
+	b := img.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+
+	// Compare srcW/srcH with width/height without floating point
+	wider := srcW*height > srcH*width
+
+	switch mode {
+	case fitPad:
+		canvasW, canvasH := srcW, srcH
+		if wider {
+			canvasH = srcW * height / width
+		} else {
+			canvasW = srcH * width / height
+		}
+		canvas := image.NewRGBA(image.Rect(0, 0, canvasW, canvasH))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+		offset := image.Pt((canvasW-srcW)/2, (canvasH-srcH)/2)
+		draw.Draw(canvas, b.Sub(b.Min).Add(offset), img, b.Min, draw.Over)
+		return canvas
+
+	case fitCrop:
+		cropW, cropH := srcW, srcH
+		if wider {
+			cropW = srcH * width / height
+		} else {
+			cropH = srcW * height / width
+		}
+		x0 := b.Min.X + (srcW-cropW)/2
+		y0 := b.Min.Y + (srcH-cropH)/2
+		out := image.NewRGBA(image.Rect(0, 0, cropW, cropH))
+		draw.Draw(out, out.Bounds(), img, image.Pt(x0, y0), draw.Src)
+		return out
+	}
+	return img
+}
+
+// fitImageData decodes an image, fits it to the ratio and re-encodes it as
+// JPEG. A safe zone, when given, keeps padded sources clear of platform UI.
+// bg fills the letterbox bars and any transparency.
+func fitImageData(data []byte, width, height int, mode string, safe *safeInsets, bg color.Color) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var fitted image.Image
+	if mode == fitPad && safe != nil {
+		fitted = padToSafeZone(img, width, height, *safe, bg)
+	} else {
+		fitted = fitToRatio(img, width, height, mode, bg)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flatten(fitted, bg), &jpeg.Options{Quality: 90}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+)
+
+// maxInlineImages is how many images /api/generate takes inline. Only a
+// first and a last frame reach the model, so more would just be dropped.
+const maxInlineImages = 2
+
+// inlineImage is an input image sent in the generate request itself. It is
+// kept in memory only and never written to uploads/.
+type inlineImage struct {
+	data      []byte
+	mediaType string
+}
+
+// parseInlineImages decodes the images[] data URLs of a generate request.
+// Each must be a JPG, PNG or WEBP within INLINE_IMAGE_MAX_MB.
+func parseInlineImages(list []string) ([]inlineImage, error) {
+	if len(list) == 0 {
+		return nil, fmt.Errorf("images must not be empty when provided")
+	}
+	if len(list) > maxInlineImages {
+		return nil, fmt.Errorf("At most %d inline images per request", maxInlineImages)
+	}
+	var out []inlineImage
+	for i, s := range list {
+		_, data, err := parseImageDataURL(s)
+		if err != nil {
+			return nil, fmt.Errorf("images[%d]: %v", i, err)
+		}
+		if int64(len(data)) > inlineImageMaxMB<<20 {
+			return nil, fmt.Errorf("images[%d] is %.1f MB; inline images are limited to %d MB (INLINE_IMAGE_MAX_MB)", i, float64(len(data))/(1<<20), inlineImageMaxMB)
+		}
+		// The declared type is only a hint; the bytes decide
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("images[%d] is not a valid JPG, PNG or WEBP image", i)
+		}
+		if err := checkPixels(cfg); err != nil {
+			return nil, fmt.Errorf("images[%d]: %v", i, err)
+		}
+		out = append(out, inlineImage{data: data, mediaType: "image/" + format})
+	}
+	return out, nil
+}
+
+// inlineBodyLimit is the /api/generate body cap when inline images are
+// enabled: every image at its limit, base64-encoded, plus the usual JSON.
+func inlineBodyLimit() int64 {
+	return maxInlineImages*(inlineImageMaxMB<<20)*4/3 + defaultBodyLimit
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Log levels, lowest first. ?level= on /api/jobs/{id}/logs is a minimum.
+const (
+	levelDebug = "debug" // provider bodies, every poll
+	levelInfo  = "info"
+	levelWarn  = "warn" // something was skipped or retried; the job went on
+	levelError = "error"
+)
+
+var levelRanks = map[string]int{levelDebug: 0, levelInfo: 1, levelWarn: 2, levelError: 3}
+
+// maxJobLogs bounds the entries kept per job. Once full, the oldest entry
+// below warn makes room, so warnings and errors outlive poll chatter.
+const maxJobLogs = 200
+
+type logEntry struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	At      string `json:"at"`
+}
+
+// jobLogf prints a "Job <id>: ..." line and keeps it with the job for
+// /api/jobs/{id}/logs. Callers must not hold jobsMu.
+func jobLogf(job *Job, level, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("Job %s: %s\n", job.logID(), msg)
+	recordJobLog(job, level, msg)
+}
+
+// recordJobLog keeps a log entry with the job without printing it.
+// Callers must not hold jobsMu.
+func recordJobLog(job *Job, level, msg string) {
+	e := logEntry{Level: level, Message: truncateBody(msg), At: timestamp()}
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	if len(job.logs) >= maxJobLogs {
+		drop := 0
+		for i, old := range job.logs {
+			if levelRanks[old.Level] < levelRanks[levelWarn] {
+				drop = i
+				break
+			}
+		}
+		job.logs = append(job.logs[:drop], job.logs[drop+1:]...)
+	}
+	job.logs = append(job.logs, e)
+}
+
+// handleJobLogs returns what the server logged about a job, oldest first,
+// at ?level= (default info) and above. Logs are kept in memory only, so a
+// restart starts them afresh.
+func handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	level := r.URL.Query().Get("level")
+	if level == "" {
+		level = levelInfo
+	}
+	floor, ok := levelRanks[level]
+	if !ok {
+		jsonError(w, "level must be one of: debug, info, warn, error", http.StatusBadRequest)
+		return
+	}
+	// Debug entries hold raw provider bodies, admin-only like /debug
+	if level == levelDebug && !isAdmin(w, r) {
+		return
+	}
+
+	jobsMu.RLock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.RUnlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	entries := []logEntry{}
+	for _, e := range job.logs {
+		if levelRanks[e.Level] >= floor {
+			entries = append(entries, e)
+		}
+	}
+	jobsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":    r.PathValue("id"),
+		"level": level,
+		"logs":  entries,
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// lastModelRunnerUse is when askModelRunner last sent a request, as Unix
+// nanoseconds. Real traffic keeps the model loaded just as well as a ping.
+var lastModelRunnerUse atomic.Int64
+
+// startModelRunnerKeepalive optionally warms MODEL_RUNNER_MODEL at startup
+// and then pings it every MODEL_RUNNER_KEEPALIVE_INTERVAL, so a local model
+// isn't unloaded between auto-prompt requests. Pings are skipped while
+// auto-prompt or other callers are using the model anyway.
+func startModelRunnerKeepalive() {
+	if !modelRunnerWarmup && modelRunnerKeepalive <= 0 {
+		return
+	}
+	go func() {
+		if modelRunnerWarmup {
+			pingModelRunner("Warm-up")
+		}
+		if modelRunnerKeepalive <= 0 {
+			return
+		}
+		for {
+			time.Sleep(modelRunnerKeepalive)
+			idle := time.Since(time.Unix(0, lastModelRunnerUse.Load()))
+			if idle >= modelRunnerKeepalive {
+				pingModelRunner("Keep-alive")
+			}
+		}
+	}()
+}
+
+// pingModelRunner sends a trivial prompt and logs how long it took; a slow
+// reply means the model had to be loaded.
+func pingModelRunner(kind string) {
+	start := time.Now()
+	_, _, err := askModelRunner(modelRunnerModel, []map[string]interface{}{
+		{"type": "text", "text": "Reply with OK."},
+	})
+	if err != nil {
+		fmt.Printf("Model Runner: %s of %s failed: %v\n", kind, modelRunnerModel, err)
+		return
+	}
+	fmt.Printf("Model Runner: %s of %s took %s\n", kind, modelRunnerModel, time.Since(start).Round(time.Millisecond))
+}
@@ -3,19 +3,30 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
+	"math"
+	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"github.com/rs/cors"
@@ -23,18 +34,149 @@ import (
 )
 
 var (
-	runwareAPIURL    = "https://api.runware.ai/v1"
+	runwareAPIURL    string
 	runwareAPIKey    string
 	useMock          = false
 	modelRunnerURL   string
 	modelRunnerModel string
+	promptModels     []string // Model Runner models auto-prompt may ask for
+	modelsConfigPath string
+	adminToken       string
+	maxUploadVideoMB int64
+
+	videoDownloadTimeout time.Duration
+	maxVideoMB           int64
+	downloadRetries      int
+	downloadBackoff      time.Duration
+	maxInlineMB          int64
+	maxVideosDiskMB      int64
+	storeVideosLocally   bool
+
+	pollBatching bool
+
+	workerCount   int
+	priorityAging time.Duration
+
+	jobsFile          string
+	uploadGracePeriod time.Duration
+
+	brokerURL     string
+	brokerSubject string
+
+	allowMockOverride bool
+
+	ffprobePath     string
+	ffmpegPath      string
+	heifConvertPath string
+	captionStyle    string
+
+	videoMetadata   bool
+	metadataTitle   string
+	metadataArtist  string
+	metadataComment string
+
+	autoPromptMaxImages   int
+	autoPromptJPEGQuality int
+	autoPromptMaxEdge     int
+
+	corsMethods string
+	corsHeaders string
+
+	safeZoneSpec string
+
+	resumeMaxAge time.Duration
+
+	templatesFile string
+	tempDir       string
+	samplesDir    string
+
+	maxStatusWait   time.Duration
+	maxGenerateWait time.Duration
+	bodyLimitSpec   string
+
+	bgRemovalURL     string
+	bgRemovalTimeout time.Duration
+
+	modelRunnerKeepalive time.Duration
+	modelRunnerWarmup    bool
+
+	enabledStyles []string // style IDs requests may use; empty allows all
+
+	inlineImages     bool
+	inlineImageMaxMB int64
 )
 
 func init() {
 	loadEnvFile(".env")
-	runwareAPIKey = getEnv("RUNWARE_API_KEY", "")
+	runwareAPIKey = getSecret("RUNWARE_API_KEY")
+	runwareAPIURL = getEnv("RUNWARE_API_URL", "https://api.runware.ai/v1")
+	runwareRegionSpec = getEnv("RUNWARE_REGIONS", "")
 	modelRunnerURL = getEnv("MODEL_RUNNER_URL", "http://localhost:12434/engines/llama.cpp/v1/chat/completions")
 	modelRunnerModel = getEnv("MODEL_RUNNER_MODEL", "ai/gemma3:4B-Q4_K_M")
+	promptModels = []string{modelRunnerModel}
+	for _, m := range splitList(getEnv("MODEL_RUNNER_MODELS", "")) {
+		if m != modelRunnerModel {
+			promptModels = append(promptModels, m)
+		}
+	}
+	modelsConfigPath = getEnv("MODELS_CONFIG", "models.json")
+	adminToken = getSecret("ADMIN_TOKEN")
+	maxUploadVideoMB = getEnvInt("MAX_UPLOAD_VIDEO_MB", 50)
+	videoDownloadTimeout = getEnvDuration("VIDEO_DOWNLOAD_TIMEOUT", 2*time.Minute)
+	maxVideoMB = getEnvInt("MAX_VIDEO_MB", 500)
+	downloadRetries = int(getEnvInt("DOWNLOAD_RETRIES", 3))
+	downloadBackoff = getEnvDuration("DOWNLOAD_RETRY_BACKOFF", 2*time.Second)
+	maxInlineMB = getEnvInt("MAX_INLINE_MB", 5)
+	maxVideosDiskMB = getEnvInt("MAX_VIDEOS_DISK_MB", 0)
+	storeVideosLocally = getEnv("STORE_VIDEOS_LOCALLY", "true") == "true"
+	pollBatching = getEnv("POLL_BATCHING", "true") == "true"
+	workerCount = int(getEnvInt("WORKER_COUNT", 4))
+	priorityAging = getEnvDuration("PRIORITY_AGING", 2*time.Minute)
+	jobsFile = getEnv("JOBS_FILE", "jobs.json")
+	uploadGracePeriod = getEnvDuration("UPLOAD_GRACE_PERIOD", 24*time.Hour)
+	brokerURL = getSecret("BROKER_URL")
+	brokerSubject = getEnv("BROKER_SUBJECT", "adsvideogen.jobs")
+	allowMockOverride = getEnv("ALLOW_MOCK_OVERRIDE", "false") == "true"
+	ffprobePath = getEnv("FFPROBE_PATH", "ffprobe")
+	ffmpegPath = getEnv("FFMPEG_PATH", "ffmpeg")
+	heifConvertPath = getEnv("HEIF_CONVERT_PATH", "heif-convert")
+	captionStyle = getEnv("CAPTION_STYLE", "FontName=Arial,FontSize=16,PrimaryColour=&H00FFFFFF,OutlineColour=&H00000000,BorderStyle=1,Outline=2,Alignment=2,MarginV=40")
+	videoMetadata = getEnv("VIDEO_METADATA", "true") == "true"
+	metadataTitle = getEnv("METADATA_TITLE", "{product}")
+	metadataArtist = getEnv("METADATA_ARTIST", "")
+	metadataComment = getEnv("METADATA_COMMENT", "{prompt} (model: {model})")
+	autoPromptMaxImages = int(getEnvInt("AUTO_PROMPT_MAX_IMAGES", 4))
+	autoPromptJPEGQuality = int(getEnvInt("AUTO_PROMPT_JPEG_QUALITY", 80))
+	autoPromptMaxEdge = int(getEnvInt("AUTO_PROMPT_MAX_EDGE", 0))
+	autoPromptProgressive = getEnv("AUTO_PROMPT_JPEG_PROGRESSIVE", "false") == "true"
+	autoPromptSubsampling = getEnv("AUTO_PROMPT_JPEG_SUBSAMPLING", "420")
+	cjpegPath = getEnv("CJPEG_PATH", "cjpeg")
+	corsMethods = getEnv("CORS_METHODS", "")
+	corsHeaders = getEnv("CORS_HEADERS", "")
+	safeZoneSpec = getEnv("SAFE_ZONES", "")
+	resumeMaxAge = getEnvDuration("RESUME_MAX_AGE", 30*time.Minute)
+	reapAfter = getEnvDuration("REAP_AFTER", 20*time.Minute)
+	reapInterval = getEnvDuration("REAP_INTERVAL", 5*time.Minute)
+	templatesFile = getEnv("TEMPLATES_FILE", "templates.json")
+	tempDir = getEnv("TEMP_DIR", "")
+	samplesDir = getEnv("SAMPLES_DIR", "samples")
+	maxStatusWait = getEnvDuration("MAX_STATUS_WAIT", 60*time.Second)
+	maxGenerateWait = getEnvDuration("MAX_GENERATE_WAIT", 10*time.Minute)
+	bodyLimitSpec = getEnv("BODY_LIMITS", "")
+	bgRemovalURL = getEnv("BG_REMOVAL_URL", "")
+	bgRemovalTimeout = getEnvDuration("BG_REMOVAL_TIMEOUT", 60*time.Second)
+	modelRunnerKeepalive = getEnvDuration("MODEL_RUNNER_KEEPALIVE_INTERVAL", 0)
+	modelRunnerWarmup = getEnv("MODEL_RUNNER_WARMUP", "false") == "true"
+	enabledStyles = splitList(getEnv("ENABLED_STYLES", ""))
+	inlineImages = getEnv("INLINE_IMAGES", "false") == "true"
+	inlineImageMaxMB = getEnvInt("INLINE_IMAGE_MAX_MB", 10)
+	uploadMaxEdge = int(getEnvInt("UPLOAD_MAX_EDGE", 2048))
+	uploadMaxPixels = int(getEnvInt("UPLOAD_MAX_PIXELS", 50000000))
+	uploadKeepOriginal = getEnv("UPLOAD_KEEP_ORIGINAL", "false") == "true"
+	sniffImageTypes = getEnv("SNIFF_IMAGE_TYPES", "true") == "true"
+	callbackAllowPrivate = getEnv("CALLBACK_ALLOW_PRIVATE", "false") == "true"
+	thumbnailFormat = getEnv("THUMBNAIL_FORMAT", "jpeg")
+	thumbnailMaxEdge = int(getEnvInt("THUMBNAIL_MAX_EDGE", 480))
 }
 
 func loadEnvFile(path string) {
@@ -68,18 +210,53 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-// All available models
-var availableModels = map[string]struct {
-	Name  string
-	Price float64
-}{
-	"google:3@3":   {Name: "Veo 3.1 Fast", Price: 0.80},
-	"pixverse:1@7": {Name: "PixVerse v5.6", Price: 0.24},
-	"vidu:4@2":     {Name: "Vidu Q3 Turbo", Price: 0.13},
-	"vidu:4@1":     {Name: "Vidu Q3", Price: 0.05},
+// getSecret reads a secret from the file named by KEY_FILE, as mounted by
+// Kubernetes or Docker secrets, and falls back to KEY itself. The file wins
+// when both are set. An unreadable file stops startup rather than running
+// without the secret.
+func getSecret(key string) string {
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return getEnv(key, "")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("ERROR: %s_FILE: %v\n", key, err)
+		os.Exit(1)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+func getEnvInt(key string, fallback int64) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return v
 }
 
+// Limits for per-request variations
+const (
+	maxPromptVariations = 8
+	maxStyleVariations  = 6
+	maxPromptLength     = 2000
+	maxCount            = 4
+	maxDuration         = 16
+	defaultDuration     = 4
+)
+
 // Aspect ratio presets (720p)
+// defaultRatio applies when neither the request nor its style picks one.
+const defaultRatio = "9:16"
+
 var ratioSizes = map[string][2]int{
 	"9:16": {720, 1280},
 	"16:9": {1280, 720},
@@ -87,19 +264,110 @@ var ratioSizes = map[string][2]int{
 }
 
 type Job struct {
-	ID        string `json:"id"`
-	Status    string `json:"status"`
-	VideoURL  string `json:"video_url,omitempty"`
-	Prompt    string `json:"prompt"`
-	Model     string `json:"model"`
-	Ratio     string `json:"ratio"`
-	Duration  int    `json:"duration"`
-	CreatedAt string `json:"created_at"`
-	Error     string `json:"error,omitempty"`
+	ID                string `json:"id"`
+	Status            string `json:"status"`
+	VideoURL          string `json:"video_url,omitempty"`
+	RemoteVideoURL    string `json:"remote_video_url,omitempty"`
+	Prompt            string `json:"prompt"`
+	NegativePrompt    string `json:"negative_prompt,omitempty"` // model, style and request negatives combined
+	Product           string `json:"product_name,omitempty"`
+	Model             string `json:"model"`
+	Style             string `json:"style,omitempty"`
+	Ratio             string `json:"ratio"`
+	Duration          int    `json:"duration"`                     // seconds sent to the provider
+	RequestedDuration int    `json:"requested_duration,omitempty"` // as given, in DurationUnit
+	DurationUnit      string `json:"duration_unit,omitempty"`      // set when the request gave a duration
+	Seed              int64  `json:"seed,omitempty"`               // sent to Runware, see seed.go
+	Fit               string `json:"fit,omitempty"`
+	SafeZone          bool   `json:"safe_zone,omitempty"`
+	Background        string `json:"background_color,omitempty"`
+	Cutout            bool   `json:"remove_background,omitempty"`
+	Blur              bool   `json:"blur_background,omitempty"`
+	EndOnProduct      bool   `json:"end_on_product,omitempty"` // last frame is the first product image
+	Priority          string `json:"priority"`
+	GroupID           string `json:"group_id,omitempty"`
+	Project           string `json:"project_id,omitempty"`
+	Note              string `json:"note,omitempty"`
+	Experiment        string `json:"experiment,omitempty"`
+	Variant           string `json:"variant,omitempty"`
+	RequestID         string `json:"request_id,omitempty"`
+	AppVersion        string `json:"app_version,omitempty"` // X-App-Version of the creating request
+	FallbackFrom      string `json:"fallback_from,omitempty"`
+	Preview           bool   `json:"preview,omitempty"`
+	PreviewOf         string `json:"preview_of,omitempty"`
+	PromotedTo        string `json:"promoted_to,omitempty"` // full render of this preview
+	Trial             bool   `json:"trial,omitempty"`       // a /api/try-style run, rendered at the preview size
+	Mode              string `json:"mode"`
+	Mock              bool   `json:"mock,omitempty"`
+	CreatedAt         string `json:"created_at"`
+	StartedAt         string `json:"started_at,omitempty"`
+	CompletedAt       string `json:"completed_at,omitempty"`
+	GenerationSeconds int    `json:"generation_seconds,omitempty"`
+	ThumbnailURL      string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth    int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight   int    `json:"thumbnail_height,omitempty"`
+	Width             int    `json:"width,omitempty"`
+	Height            int    `json:"height,omitempty"`
+	RatioMismatch     bool   `json:"ratio_mismatch,omitempty"`
+	Captions          string `json:"captions,omitempty"`
+	CaptionsURL       string `json:"captions_url,omitempty"`
+	OutputFormat      string `json:"output_format,omitempty"`
+	OutputURL         string `json:"output_url,omitempty"` // the video in OutputFormat; VideoURL stays the original
+	Region            string `json:"region,omitempty"`     // RUNWARE_REGIONS entry the job runs in
+	Error             string `json:"error,omitempty"`
+	ErrorCategory     string `json:"error_category,omitempty"`
+	InlineImages      int    `json:"inline_images,omitempty"` // images sent in the request, not uploaded
+	PollPaused        bool   `json:"poll_paused,omitempty"`   // provider polling held by pause-poll
+
+	// Every result of the provider call, VideoURL first
+	VideoURLs []string `json:"video_urls,omitempty"`
+
+	// Structured camera/lighting/mood picks, already folded into Prompt
+	Creative *CreativeChoice `json:"creative,omitempty"`
+
+	// Free-form labels for organizing jobs, lowercased; see ?tag=
+	Tags []string `json:"tags,omitempty"`
+
+	// Feedback from POST /api/jobs/{id}/rating: 1-5, thumbs up or down,
+	// or both, with an optional comment
+	Rating        int    `json:"rating,omitempty"`
+	Thumbs        string `json:"thumbs,omitempty"`
+	RatingComment string `json:"rating_comment,omitempty"`
+
+	// What the provider charged, or the listed price when it didn't say
+	Cost float64 `json:"cost,omitempty"`
 
 	// internal, not serialized
 	imagePaths []string
-	modelID    string
+	inline     []inlineImage // request-supplied images, dropped once finished
+	videoPath  string
+	thumbPath  string
+	firstFrame string // explicit frame anchors, override imagePaths order
+	lastFrame  string
+	maskPath   string // area of the first frame to keep, see mask.go
+	narration  string // caption script, defaults to the prompt
+	model      *ModelConfig
+	fallback   *ModelConfig // style's fallback, used once if model is unavailable
+	fullDur    int          // duration a preview is promoted at
+	audio      bool
+	started    time.Time
+	taskUUID   string     // provider task being polled
+	logs       []logEntry // for /api/jobs/{id}/logs, see joblog.go
+
+	// closed by resume-poll; set while PollPaused, see pollpause.go
+	pollResumed chan struct{}
+
+	// provider transcript for /api/jobs/{id}/debug
+	debugRequest   string
+	debugResponses []debugExchange
+
+	// webhook for the finished job; the auth value is never returned
+	callbackURL  string
+	callbackAuth string
+
+	// cancelled by POST /api/jobs/{id}/cancel; see cancel.go
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 var (
@@ -109,31 +377,143 @@ var (
 
 func main() {
 	if runwareAPIKey == "" && !useMock {
-		fmt.Println("ERROR: Set RUNWARE_API_KEY in .env")
+		fmt.Println("ERROR: Set RUNWARE_API_KEY (or RUNWARE_API_KEY_FILE) in .env")
+		os.Exit(1)
+	}
+
+	if err := loadRegistry(); err != nil {
+		fmt.Printf("ERROR: Invalid model config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadSafeZones(safeZoneSpec); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if err := checkEndpoint(runwareAPIURL); err != nil {
+		fmt.Printf("ERROR: RUNWARE_API_URL: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadRegions(runwareRegionSpec); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	// Inline images arrive in the generate body; BODY_LIMITS still wins
+	if inlineImages {
+		bodyLimits["/api/generate"] = inlineBodyLimit()
+	}
+	if workerCount < 1 || workerCount > maxWorkerCount {
+		fmt.Printf("ERROR: WORKER_COUNT must be 1-%d\n", maxWorkerCount)
+		os.Exit(1)
+	}
+	if autoPromptJPEGQuality < 1 || autoPromptJPEGQuality > 100 {
+		fmt.Println("ERROR: AUTO_PROMPT_JPEG_QUALITY must be 1-100")
+		os.Exit(1)
+	}
+	if err := checkPromptJPEGConfig(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if err := checkThumbnailConfig(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	if err := loadBodyLimits(bodyLimitSpec); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
 		os.Exit(1)
 	}
 
 	os.MkdirAll("uploads", 0755)
 	os.MkdirAll("videos", 0755)
+	if tempDir != "" {
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			fmt.Printf("ERROR: Invalid TEMP_DIR: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	removeStaleTemps()
+	if err := checkStorage(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := startBroker(); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := loadJobs(); err != nil {
+		fmt.Printf("ERROR: Could not load jobs: %v\n", err)
+		os.Exit(1)
+	}
+	sweepUploads(uploadGracePeriod)
+	if err := loadTemplates(); err != nil {
+		fmt.Printf("ERROR: Could not load templates: %v\n", err)
+		os.Exit(1)
+	}
 
-	mux := http.NewServeMux()
+	startWorkers(workerCount)
+	startModelRunnerKeepalive()
+	startReaper()
+
+	mux := newRouteMux()
 
 	mux.HandleFunc("POST /api/upload", handleUpload)
+	mux.HandleFunc("POST /api/upload-multiple", handleUploadMultiple)
+	mux.HandleFunc("POST /api/upload-video", handleUploadVideo)
+	mux.HandleFunc("POST /api/upload-frame", handleUploadFrame)
+	mux.HandleFunc("POST /api/validate-image", handleValidateImage)
 	mux.HandleFunc("POST /api/generate", handleGenerate)
+	mux.HandleFunc("POST /api/generate-from-recipe", handleGenerateFromRecipe)
+	mux.HandleFunc("POST /api/generate-sequence", handleGenerateSequence)
+	mux.HandleFunc("GET /api/sequences/{id}", handleSequenceStatus)
+	mux.HandleFunc("POST /api/try-style", handleTryStyle)
 	mux.HandleFunc("POST /api/auto-prompt", handleAutoPrompt)
+	mux.HandleFunc("GET /api/auto-prompt/{token}", handlePromptTask)
 	mux.HandleFunc("GET /api/status/{id}", handleStatus)
+	mux.HandleFunc("GET /api/groups/{groupId}", handleGroupStatus)
+	mux.HandleFunc("GET /api/models", handleListModels)
+	mux.HandleFunc("GET /api/estimate", handleEstimate)
+	mux.HandleFunc("GET /api/presets", handleListPresets)
+	mux.HandleFunc("GET /api/creative-options", handleCreativeOptions)
+	mux.HandleFunc("POST /api/templates", handleCreateTemplate)
+	mux.HandleFunc("GET /api/templates", handleListTemplates)
+	mux.HandleFunc("GET /api/templates/{id}", handleGetTemplate)
+	mux.HandleFunc("DELETE /api/templates/{id}", handleDeleteTemplate)
 	mux.HandleFunc("GET /api/jobs", handleListJobs)
+	mux.HandleFunc("GET /api/projects", handleListProjects)
+	mux.HandleFunc("GET /api/sample-images", handleListSamples)
+	mux.HandleFunc("GET /api/jobs.rss", handleJobsFeed)
+	mux.HandleFunc("GET /api/openapi.json", handleOpenAPI)
 	mux.HandleFunc("GET /health", handleHealth)
+	mux.HandleFunc("GET /health/ready", handleReady)
+	mux.HandleFunc("PATCH /api/jobs/{id}", handleUpdateJob)
+	mux.HandleFunc("POST /api/jobs/{id}/promote", handlePromote)
+	mux.HandleFunc("POST /api/jobs/{id}/rating", handleRateJob)
+	mux.HandleFunc("GET /api/experiments/{name}", handleExperiment)
+	mux.HandleFunc("GET /api/stats", handleStats)
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", handleCancelJob)
+	mux.HandleFunc("POST /api/jobs/{id}/pause-poll", handlePausePoll)
+	mux.HandleFunc("POST /api/jobs/{id}/resume-poll", handleResumePoll)
+	mux.HandleFunc("POST /api/jobs/{id}/regenerate-prompt", handleRegeneratePrompt)
+	mux.HandleFunc("GET /api/jobs/{id}/recipe", handleJobRecipe)
+	mux.HandleFunc("GET /api/jobs/{id}/frame", handleJobFrame)
+	mux.HandleFunc("GET /api/jobs/{id}/logs", handleJobLogs)
+	mux.HandleFunc("GET /api/jobs/{id}/debug", requireAdmin(handleJobDebug))
+	mux.HandleFunc("POST /api/admin/reload", requireAdmin(handleAdminReload))
+	mux.HandleFunc("GET /api/admin/config", requireAdmin(handleAdminConfig))
+	mux.HandleFunc("PATCH /api/admin/config", requireAdmin(handleAdminUpdateConfig))
+	mux.HandleFunc("POST /api/admin/reap", requireAdmin(handleAdminReap))
 
 	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
 	mux.Handle("/videos/", http.StripPrefix("/videos/", http.FileServer(http.Dir("videos"))))
+	mux.Handle("/samples/", http.StripPrefix("/samples/", http.FileServer(http.Dir(samplesDir))))
 
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
-		AllowCredentials: true,
-	})
+	corsOpts, err := corsOptions(mux)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		os.Exit(1)
+	}
+	c := cors.New(corsOpts)
 
 	mode := "MOCK"
 	if !useMock {
@@ -145,7 +525,7 @@ func main() {
 	fmt.Printf("  Server:   http://localhost:8080\n")
 	fmt.Printf("  Frontend: http://localhost:3000\n\n")
 
-	if err := http.ListenAndServe(":8080", c.Handler(mux)); err != nil {
+	if err := http.ListenAndServe(":8080", withRequestID(c.Handler(mux))); err != nil {
 		fmt.Printf("Server failed: %v\n", err)
 		os.Exit(1)
 	}
@@ -161,340 +541,1728 @@ func handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	ext := filepath.Ext(header.Filename)
+	ext := strings.ToLower(filepath.Ext(header.Filename))
 	allowed := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
-	if !allowed[ext] {
-		jsonError(w, "Only JPG, PNG, WEBP images are allowed", http.StatusBadRequest)
+	if !allowed[ext] && !heifExts[ext] {
+		jsonError(w, "Only JPG, PNG, WEBP or HEIC images are allowed", http.StatusBadRequest)
 		return
 	}
+	// HEIC/HEIF is stored as the JPEG it converts to
+	convert := heifExts[ext]
+	if convert {
+		ext = ".jpg"
+	}
 
-	filename := uuid.New().String() + ext
+	project := r.FormValue("project_id")
+	if _, err := uploadDir(project); err != nil {
+		saveFailed(w, r, err, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filename := uploadName(project, uuid.New().String()+ext)
 	savePath := filepath.Join("uploads", filename)
 
-	dst, err := os.Create(savePath)
+	if convert {
+		err = convertHEIF(file, savePath)
+	} else {
+		err = writeFileAtomic(savePath, func(dst io.Writer) error {
+			_, err := io.Copy(dst, file)
+			return err
+		})
+	}
+	if err != nil {
+		imageSaveFailed(w, r, err, "Failed to save image")
+		return
+	}
+	// The extension only says what the client called the file
+	if savePath, err = checkUploadType(savePath); err != nil {
+		os.Remove(filepath.Join("uploads", filename))
+		if errors.Is(err, errNotImage) {
+			jsonError(w, "File is not a valid JPG, PNG or WEBP image", http.StatusBadRequest)
+			return
+		}
+		saveFailed(w, r, err, "Failed to save image", http.StatusInternalServerError)
+		return
+	}
+	stored, err := ingestUpload(r, savePath)
 	if err != nil {
-		jsonError(w, "Failed to save image", http.StatusInternalServerError)
+		os.Remove(savePath)
+		imageSaveFailed(w, r, err, "Failed to save image")
 		return
 	}
-	defer dst.Close()
-	io.Copy(dst, file)
 
+	resp := uploadFields(project, stored)
+	resp["message"] = "Image uploaded successfully"
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":   "Image uploaded successfully",
-		"filename":  filename,
-		"image_url": fmt.Sprintf("http://localhost:8080/uploads/%s", filename),
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
-func handleAutoPrompt(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Filenames      []string `json:"filenames"`
-		ProductName    string   `json:"product_name"`
-		SceneNumber    int      `json:"scene_number"`
-		TotalScenes    int      `json:"total_scenes"`
-		Duration       int      `json:"duration"`
-		PreviousPrompts []string `json:"previous_prompts"` // prompts from earlier scenes
+// handleUploadMultiple saves several images all-or-nothing: files are
+// staged in a temp directory and only moved into uploads/ once every one
+// has been written. On any failure nothing is kept.
+func handleUploadMultiple(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		jsonError(w, "Invalid multipart form", http.StatusBadRequest)
+		return
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonError(w, "Invalid request body", http.StatusBadRequest)
+	headers := r.MultipartForm.File["images"]
+	if len(headers) == 0 {
+		jsonError(w, "No image files provided", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.Filenames) == 0 {
-		jsonError(w, "filenames is required", http.StatusBadRequest)
+	project := r.FormValue("project_id")
+	dir, err := uploadDir(project)
+	if err != nil {
+		saveFailed(w, r, err, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Encode all images as JPEG base64
-	var imageBase64s []string
-	for _, fn := range req.Filenames {
-		imgPath := filepath.Join("uploads", fn)
-		if _, err := os.Stat(imgPath); os.IsNotExist(err) {
-			continue
+	allowed := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+	for _, h := range headers {
+		ext := strings.ToLower(filepath.Ext(h.Filename))
+		if !allowed[ext] && !heifExts[ext] {
+			jsonError(w, fmt.Sprintf("%s: only JPG, PNG, WEBP or HEIC images are allowed; nothing was saved", h.Filename), http.StatusBadRequest)
+			return
 		}
+	}
 
-		imgFile, err := os.Open(imgPath)
-		if err != nil {
-			continue
+	stageRoot := tempDir
+	if stageRoot == "" {
+		stageRoot = "uploads"
+	}
+	stageDir, err := os.MkdirTemp(stageRoot, tempPrefix)
+	if err != nil {
+		saveFailed(w, r, err, "Failed to save images; nothing was saved", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(stageDir)
+
+	staged := make([]storedImage, 0, len(headers))
+	var filenames []string // every staged file, kept originals included
+	for _, h := range headers {
+		ext := strings.ToLower(filepath.Ext(h.Filename))
+		if heifExts[ext] {
+			ext = ".jpg"
+		}
+		path := filepath.Join(stageDir, uuid.New().String()+ext)
+		err := stageUpload(h, path)
+		if err == nil {
+			path, err = checkUploadType(path)
+		}
+		if errors.Is(err, errNotImage) {
+			jsonError(w, fmt.Sprintf("%s is not a valid JPG, PNG or WEBP image; nothing was saved", h.Filename), http.StatusBadRequest)
+			return
+		}
+		var stored storedImage
+		if err == nil {
+			stored, err = ingestUpload(r, path)
 		}
-
-		img, _, err := image.Decode(imgFile)
-		imgFile.Close()
 		if err != nil {
-			continue
+			fmt.Printf("Upload%s: Staging %s failed: %v\n", reqTag(requestID(r.Context())), h.Filename, err)
+			imageSaveFailed(w, r, err, fmt.Sprintf("Failed to save %s; nothing was saved", h.Filename))
+			return
 		}
-
-		var jpegBuf bytes.Buffer
-		if err := jpeg.Encode(&jpegBuf, img, &jpeg.Options{Quality: 80}); err != nil {
-			continue
+		staged = append(staged, stored)
+		filenames = append(filenames, filepath.Base(stored.path))
+		if stored.original != "" {
+			filenames = append(filenames, filepath.Base(stored.original))
 		}
-
-		b64 := fmt.Sprintf("data:image/jpeg;base64,%s", base64.StdEncoding.EncodeToString(jpegBuf.Bytes()))
-		imageBase64s = append(imageBase64s, b64)
-		fmt.Printf("AutoPrompt: Image %s converted to JPEG (%d KB)\n", fn, jpegBuf.Len()/1024)
 	}
 
-	if len(imageBase64s) == 0 {
-		jsonError(w, "No valid images found", http.StatusBadRequest)
-		return
+	// Commit: move everything into place, undoing the moves on failure
+	var moved []string
+	for _, fn := range filenames {
+		dst := filepath.Join(dir, fn)
+		if err := commitTemp(filepath.Join(stageDir, fn), dst); err != nil {
+			for _, m := range moved {
+				os.Remove(m)
+			}
+			fmt.Printf("Upload%s: Commit failed: %v\n", reqTag(requestID(r.Context())), err)
+			saveFailed(w, r, err, "Failed to save images; nothing was saved", http.StatusInternalServerError)
+			return
+		}
+		moved = append(moved, dst)
 	}
 
-	productCtx := "a product"
-	if req.ProductName != "" {
-		productCtx = req.ProductName
+	files := make([]map[string]interface{}, 0, len(staged))
+	for _, stored := range staged {
+		files = append(files, uploadFields(project, stored))
 	}
 
-	sceneNum := req.SceneNumber
-	if sceneNum < 1 {
-		sceneNum = 1
-	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("%d images uploaded successfully", len(files)),
+		"files":   files,
+	})
+}
 
-	dur := req.Duration
-	if dur < 1 {
-		dur = 4
+func stageUpload(h *multipart.FileHeader, path string) error {
+	src, err := h.Open()
+	if err != nil {
+		return err
 	}
+	defer src.Close()
 
-	// Build context about previous scenes so the LLM knows what was already covered
-	previousCtx := ""
-	if len(req.PreviousPrompts) > 0 {
-		previousCtx = "Previous scenes already done:\n"
-		for i, p := range req.PreviousPrompts {
-			previousCtx += fmt.Sprintf("  Scene %d: %s\n", i+1, p)
-		}
-		previousCtx += fmt.Sprintf("Now write scene %d. Do NOT repeat what previous scenes already show. Use a different camera move, angle, or setting.\n", sceneNum)
+	if heifExts[strings.ToLower(filepath.Ext(h.Filename))] {
+		return convertHEIF(src, path)
 	}
-
-	userPrompt := fmt.Sprintf(
-		"Write a short video prompt for a %d-second ad scene for %s (shown in the attached images). "+
-			"%s"+
-			"RULES: "+
-			"1-2 sentences MAXIMUM. "+
-			"One camera move, one action. "+
-			"Include: camera move + lighting + mood. "+
-			"Do NOT describe the product appearance. "+
-			"Do NOT use labels like 'Camera:', 'Lighting:', 'Scene:'. "+
-			"Do NOT say the duration. "+
-			"Just write the prompt as a plain sentence. "+
-			"Example: 'Slow orbit around the product on marble surface. Warm rim lighting, soft bokeh. Premium feel.' "+
-			"Output ONLY the prompt.",
-		dur, productCtx, previousCtx,
-	)
-
-	// Build message content: text + all images
-	contentParts := []map[string]interface{}{
-		{
-			"type": "text",
-			"text": userPrompt,
-		},
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
 	}
-	for _, b64 := range imageBase64s {
-		contentParts = append(contentParts, map[string]interface{}{
-			"type": "image_url",
-			"image_url": map[string]string{
-				"url": b64,
-			},
-		})
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
 	}
+	return dst.Close()
+}
 
-	chatPayload := map[string]interface{}{
-		"model": modelRunnerModel,
-		"messages": []map[string]interface{}{
-			{
-				"role":    "user",
-				"content": contentParts,
-			},
-		},
-		"max_tokens": 300,
+func handleUploadVideo(w http.ResponseWriter, r *http.Request) {
+	maxBytes := maxUploadVideoMB << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		jsonError(w, fmt.Sprintf("Video too large or malformed (max %d MB)", maxUploadVideoMB), http.StatusRequestEntityTooLarge)
+		return
 	}
 
-	chatBody, _ := json.Marshal(chatPayload)
-
-	fmt.Printf("AutoPrompt: Sending %d image(s) to %s (scene %d/%d)...\n", len(imageBase64s), modelRunnerModel, sceneNum, req.TotalScenes)
-
-	client := &http.Client{Timeout: 60 * time.Second}
-	httpReq, _ := http.NewRequest("POST", modelRunnerURL, bytes.NewBuffer(chatBody))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(httpReq)
+	file, header, err := r.FormFile("video")
 	if err != nil {
-		jsonError(w, fmt.Sprintf("Model Runner error: %v", err), http.StatusInternalServerError)
+		jsonError(w, "No video file provided", http.StatusBadRequest)
 		return
 	}
-	defer resp.Body.Close()
+	defer file.Close()
 
-	body, _ := io.ReadAll(resp.Body)
+	if header.Size > maxBytes {
+		jsonError(w, fmt.Sprintf("Video exceeds %d MB", maxUploadVideoMB), http.StatusRequestEntityTooLarge)
+		return
+	}
 
-	if resp.StatusCode != 200 {
-		jsonError(w, fmt.Sprintf("Model Runner %d: %s", resp.StatusCode, string(body)), http.StatusInternalServerError)
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	allowed := map[string]bool{".mp4": true, ".mov": true, ".webm": true}
+	if !allowed[ext] {
+		jsonError(w, "Only MP4, MOV, WEBM videos are allowed", http.StatusBadRequest)
 		return
 	}
 
-	var chatResp struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	// Check the container magic rather than trusting the extension
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(file, head)
+	if !isVideoContainer(head[:n]) || isHEIF(head[:n]) {
+		jsonError(w, "File is not a valid MP4, MOV or WEBM video", http.StatusBadRequest)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		jsonError(w, "Failed to read video", http.StatusInternalServerError)
+		return
 	}
 
-	if err := json.Unmarshal(body, &chatResp); err != nil || len(chatResp.Choices) == 0 {
-		jsonError(w, "Failed to parse model response", http.StatusInternalServerError)
+	project := r.FormValue("project_id")
+	if _, err := uploadDir(project); err != nil {
+		saveFailed(w, r, err, err.Error(), http.StatusBadRequest)
 		return
 	}
+	filename := uploadName(project, uuid.New().String()+ext)
+	savePath := filepath.Join("uploads", filename)
 
-	prompt := chatResp.Choices[0].Message.Content
-	fmt.Printf("AutoPrompt: Generated → %s\n", prompt)
+	err = writeFileAtomic(savePath, func(dst io.Writer) error {
+		_, err := io.Copy(dst, file)
+		return err
+	})
+	if err != nil {
+		saveFailed(w, r, err, "Failed to save video", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"prompt": prompt,
+		"message":   "Video uploaded successfully",
+		"filename":  filename,
+		"video_url": fmt.Sprintf("http://localhost:8080/uploads/%s", filename),
 	})
 }
 
-func handleGenerate(w http.ResponseWriter, r *http.Request) {
+// handleUploadFrame saves a frame captured from a canvas, sent as a data URL
+// or as bare base64, so it can be used as a generation input.
+func handleUploadFrame(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Filenames   []string `json:"filenames"`
-		Prompt      string   `json:"prompt"`
-		Model       string   `json:"model"`
-		Ratio       string   `json:"ratio"`
-		ProductName string   `json:"product_name"`
+		Image     string `json:"image"`
+		Format    string `json:"format"` // "jpeg" (default) or "png"
+		ProjectID string `json:"project_id"`
+		// What transparent areas become when saved as JPEG
+		BackgroundColor string `json:"background_color"`
 	}
-
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		jsonError(w, "Invalid request body", http.StatusBadRequest)
+		bodyError(w, err)
 		return
 	}
-
-	if len(req.Filenames) == 0 {
-		jsonError(w, "filenames is required", http.StatusBadRequest)
+	if req.Image == "" {
+		jsonError(w, "image is required", http.StatusBadRequest)
 		return
 	}
 
-	// Validate model
-	modelInfo, ok := availableModels[req.Model]
-	if !ok {
-		jsonError(w, fmt.Sprintf("Unknown model: %s", req.Model), http.StatusBadRequest)
+	// JPEG suits photos; PNG keeps sharp edges and text in UI mockups or
+	// labels lossless.
+	format := req.Format
+	if format == "" {
+		format = "jpeg"
+	}
+	if format != "jpeg" && format != "png" {
+		jsonError(w, "format must be jpeg or png", http.StatusBadRequest)
 		return
 	}
-
-	// Validate images exist
-	var imagePaths []string
-	for _, fn := range req.Filenames {
-		p := filepath.Join("uploads", fn)
-		if _, err := os.Stat(p); os.IsNotExist(err) {
-			jsonError(w, fmt.Sprintf("Image not found: %s", fn), http.StatusBadRequest)
-			return
-		}
-		imagePaths = append(imagePaths, p)
+	bg, err := backgroundColor(req.BackgroundColor)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Build prompt — use provided prompt, or a simple default
-	finalPrompt := req.Prompt
-	if finalPrompt == "" {
-		if req.ProductName != "" {
-			finalPrompt = fmt.Sprintf("Commercial advertisement for %s. Slow orbit, dramatic lighting, premium aesthetic. Sharp focus.", req.ProductName)
-		} else {
-			finalPrompt = "Commercial advertisement for a product. Slow orbit, dramatic lighting, premium aesthetic. Sharp focus."
-		}
+	_, data, err := parseImageDataURL(req.Image)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Default ratio
-	ratio := req.Ratio
-	if _, ok := ratioSizes[ratio]; !ok {
-		ratio = "9:16"
+	// The header alone tells how much memory decoding would take
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		jsonError(w, "Frame is not a valid JPG, PNG or WEBP image", http.StatusBadRequest)
+		return
 	}
-
-	job := &Job{
-		ID:         uuid.New().String()[:12],
-		Status:     "processing",
-		Prompt:     finalPrompt,
-		Model:      modelInfo.Name,
-		Ratio:      ratio,
-		Duration:   4,
-		CreatedAt:  time.Now().Format(time.RFC3339),
-		imagePaths: imagePaths,
-		modelID:    req.Model,
+	if err := checkPixels(cfg); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		jsonError(w, "Frame is not a valid JPG, PNG or WEBP image", http.StatusBadRequest)
+		return
 	}
 
-	jobsMu.Lock()
-	jobs[job.ID] = job
-	jobsMu.Unlock()
-
-	if useMock {
-		go mockGenerate(job)
-	} else {
-		go runwareGenerate(job)
+	ext := ".jpg"
+	if format == "png" {
+		ext = ".png"
+	}
+	if _, err := uploadDir(req.ProjectID); err != nil {
+		saveFailed(w, r, err, err.Error(), http.StatusBadRequest)
+		return
 	}
+	filename := uploadName(req.ProjectID, uuid.New().String()+ext)
+	savePath := filepath.Join("uploads", filename)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"job_id":  job.ID,
-		"status":  "processing",
-		"message": "Video generation started",
+	err = writeFileAtomic(savePath, func(dst io.Writer) error {
+		if format == "png" {
+			return png.Encode(dst, img)
+		}
+		return jpeg.Encode(dst, flatten(img, bg), &jpeg.Options{Quality: 90})
 	})
-}
+	if err != nil {
+		saveFailed(w, r, err, "Failed to save frame", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":   "Frame uploaded successfully",
+		"filename":  filename,
+		"image_url": fmt.Sprintf("http://localhost:8080/uploads/%s", filename),
+	})
+}
+
+// parseImageDataURL decodes a "data:<mime>;base64,<data>" URL, or bare base64
+// when there is no data: prefix. The declared MIME type must be an allowed
+// image type; it is returned empty for bare base64.
+func parseImageDataURL(s string) (string, []byte, error) {
+	mediaType := ""
+	payload := s
+	if strings.HasPrefix(s, "data:") {
+		header, rest, ok := strings.Cut(s[len("data:"):], ",")
+		if !ok {
+			return "", nil, errors.New("Malformed data URL: missing comma before the image data")
+		}
+		mime, isBase64 := strings.CutSuffix(header, ";base64")
+		if !isBase64 {
+			return "", nil, errors.New("Malformed data URL: image data must be base64-encoded")
+		}
+		allowed := map[string]bool{"image/jpeg": true, "image/png": true, "image/webp": true}
+		if !allowed[mime] {
+			return "", nil, fmt.Errorf("Unsupported data URL type %q: only image/jpeg, image/png, image/webp are allowed", mime)
+		}
+		mediaType = mime
+		payload = rest
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", nil, errors.New("Image data is not valid base64")
+	}
+	return mediaType, data, nil
+}
+
+// pickRepresentative returns at most limit filenames spread evenly across
+// the list, always keeping the first and last angle. A limit of zero or less
+// keeps everything.
+func pickRepresentative(filenames []string, limit int) []string {
+	n := len(filenames)
+	if limit <= 0 || n <= limit {
+		return filenames
+	}
+	if limit == 1 {
+		return filenames[:1]
+	}
+	picked := make([]string, 0, limit)
+	for i := 0; i < limit; i++ {
+		picked = append(picked, filenames[i*(n-1)/(limit-1)])
+	}
+	return picked
+}
+
+// isVideoContainer reports whether head starts like an MP4/MOV (ftyp box)
+// or WEBM (EBML header) file.
+func isVideoContainer(head []byte) bool {
+	if len(head) >= 8 && string(head[4:8]) == "ftyp" {
+		return true
+	}
+	return len(head) >= 4 && bytes.Equal(head[:4], []byte{0x1A, 0x45, 0xDF, 0xA3})
+}
+
+func handleAutoPrompt(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filenames       []string `json:"filenames"`
+		ProductName     string   `json:"product_name"`
+		SceneNumber     int      `json:"scene_number"`
+		TotalScenes     int      `json:"total_scenes"`
+		Duration        int      `json:"duration"`
+		PreviousPrompts []string `json:"previous_prompts"` // prompts from earlier scenes
+		MaxImages       int      `json:"max_images"`
+		Model           string   `json:"model"` // Model Runner model, from MODEL_RUNNER_MODELS
+		Style           string   `json:"style"` // ad style the prompt should stay within
+		// Fill behind transparent images, as hex; defaults to white
+		BackgroundColor string `json:"background_color"`
+		// Last frame of the previous scene; always sent, taking one slot of the cap
+		ContinuationFilename string `json:"continuation_filename"`
+		// With ?async=true, where to POST the result
+		CallbackURL        string `json:"callback_url"`
+		CallbackAuthHeader string `json:"callback_auth_header"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	if len(req.Filenames) == 0 && req.ContinuationFilename == "" {
+		jsonError(w, "filenames is required", http.StatusBadRequest)
+		return
+	}
+	async := r.URL.Query().Get("async") == "true"
+	if err := checkCallback(req.CallbackURL, req.CallbackAuthHeader); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.CallbackURL != "" && !async {
+		jsonError(w, "callback_url needs ?async=true", http.StatusBadRequest)
+		return
+	}
+
+	chatModel, err := chatModelFor(req.Model)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var style *StyleConfig
+	if req.Style != "" {
+		reg := snapshot()
+		s, ok := reg.style(req.Style)
+		if !ok {
+			jsonError(w, fmt.Sprintf("Unknown style: %s", req.Style), http.StatusBadRequest)
+			return
+		}
+		if rejectDisabledStyles(w, reg, s.ID) {
+			return
+		}
+		style = s
+	}
+	bg, err := backgroundColor(req.BackgroundColor)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The request can lower the configured cap but not raise it
+	limit := autoPromptMaxImages
+	if req.MaxImages > 0 && (limit <= 0 || req.MaxImages < limit) {
+		limit = req.MaxImages
+	}
+	spec := autoPromptSpec{
+		chatModel:    chatModel,
+		filenames:    promptFilenames(req.Filenames, req.ContinuationFilename, limit),
+		continuation: req.ContinuationFilename,
+		bg:           bg,
+		brief: promptBrief{
+			product:  req.ProductName,
+			scene:    req.SceneNumber,
+			total:    req.TotalScenes,
+			duration: req.Duration,
+			previous: req.PreviousPrompts,
+			style:    style,
+		},
+	}
+	if async {
+		startPromptTask(w, r, spec, req.CallbackURL, req.CallbackAuthHeader)
+		return
+	}
+
+	result, status, err := autoPrompt(r.Context(), spec)
+	if err != nil {
+		jsonError(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// promptFilenames picks up to limit images to send the vision model. A
+// continuation frame is always sent and takes one slot of the cap.
+func promptFilenames(filenames []string, continuation string, limit int) []string {
+	if continuation == "" {
+		return pickRepresentative(filenames, limit)
+	}
+	switch {
+	case limit == 1:
+		filenames = nil
+	case limit > 1:
+		filenames = pickRepresentative(filenames, limit-1)
+	}
+	return append(slices.Clip(filenames), continuation)
+}
+
+// autoPromptSpec is a validated auto-prompt request.
+type autoPromptSpec struct {
+	chatModel    string
+	filenames    []string // already capped, continuation frame included
+	continuation string
+	bg           color.Color
+	brief        promptBrief
+}
+
+// autoPrompt encodes the spec's images and has the vision model write a
+// prompt for them. On error the int is the HTTP status to report.
+func autoPrompt(ctx context.Context, spec autoPromptSpec) (map[string]interface{}, int, error) {
+	// Encode the selected images as JPEG base64
+	var imageBase64s []string
+	var used []string
+	var warnings []string
+	for _, fn := range spec.filenames {
+		imgPath, err := resolveUpload(fn)
+		if err != nil {
+			continue
+		}
+		b64, warning, err := promptImage(ctx, fn, imgPath, spec.bg)
+		if err != nil {
+			continue
+		}
+		imageBase64s = append(imageBase64s, b64)
+		used = append(used, fn)
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+
+	if len(imageBase64s) == 0 {
+		return nil, http.StatusBadRequest, errors.New("No valid images found")
+	}
+
+	start := time.Now()
+	prompt, usage, status, err := writeAdPrompt(ctx, spec.chatModel, imageBase64s, spec.brief)
+	if err != nil {
+		return nil, status, err
+	}
+
+	result := map[string]interface{}{
+		"prompt":       prompt,
+		"model":        spec.chatModel,
+		"images_used":  used,
+		"images_sent":  len(used),
+		"continuation": spec.continuation != "" && slices.Contains(used, spec.continuation),
+		"usage":        usage,
+		"latency_ms":   time.Since(start).Milliseconds(),
+	}
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+	return result, http.StatusOK, nil
+}
+
+// chatModelFor resolves the Model Runner model a request asked for,
+// defaulting to MODEL_RUNNER_MODEL and refusing anything not configured.
+func chatModelFor(requested string) (string, error) {
+	if requested == "" {
+		return modelRunnerModel, nil
+	}
+	if !slices.Contains(promptModels, requested) {
+		return "", fmt.Errorf("Model %s is not allowed; choose one of: %s", requested, strings.Join(promptModels, ", "))
+	}
+	return requested, nil
+}
+
+// promptImage encodes an image as a data URL for the vision model,
+// re-encoded as JPEG over bg. Unusual but valid variants can trip the decoder, so
+// those are sent as their original bytes with a warning rather than dropped.
+func promptImage(ctx context.Context, name, imgPath string, bg color.Color) (string, string, error) {
+	imageData, err := os.ReadFile(imgPath)
+	if err != nil {
+		return "", "", err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(imageData))
+	if err != nil {
+		mediaType := http.DetectContentType(imageData)
+		if !strings.HasPrefix(mediaType, "image/") {
+			mediaType = mediaTypeForPath(imgPath)
+		}
+		fmt.Printf("AutoPrompt%s: Image %s decode failed (%v), sending raw %s\n", reqTag(requestID(ctx)), name, err, mediaType)
+		b64 := fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(imageData))
+		return b64, fmt.Sprintf("%s could not be decoded (%v); sent original %s bytes", name, err, mediaType), nil
+	}
+
+	jpegData, err := encodePromptJPEG(img, bg)
+	if err != nil {
+		return "", "", err
+	}
+	fmt.Printf("AutoPrompt%s: Image %s converted to JPEG (%d KB)\n", reqTag(requestID(ctx)), name, len(jpegData)/1024)
+	return fmt.Sprintf("data:image/jpeg;base64,%s", base64.StdEncoding.EncodeToString(jpegData)), "", nil
+}
+
+// promptBrief is what the vision model is told about the scene it writes.
+type promptBrief struct {
+	product  string
+	scene    int
+	total    int
+	duration int
+	previous []string     // prompts of earlier scenes, not to be repeated
+	style    *StyleConfig // optional direction to stay within
+	rejected string       // earlier prompt for the same images to move away from
+	hint     string       // what this scene should show, from a sequence segment
+}
+
+// writeAdPrompt asks chatModel for a video prompt for the encoded images,
+// nudging it once if it replies with nothing. The usage adds up both calls.
+// On error the int is the HTTP status to report.
+func writeAdPrompt(ctx context.Context, chatModel string, images []string, brief promptBrief) (string, tokenUsage, int, error) {
+	tag := reqTag(requestID(ctx))
+	productCtx := "a product"
+	if brief.product != "" {
+		productCtx = brief.product
+	}
+
+	sceneNum := brief.scene
+	if sceneNum < 1 {
+		sceneNum = 1
+	}
+
+	dur := brief.duration
+	if dur < 1 {
+		dur = 4
+	}
+
+	// Build context about previous scenes so the LLM knows what was already covered
+	previousCtx := ""
+	if len(brief.previous) > 0 {
+		previousCtx = "Previous scenes already done:\n"
+		for i, p := range brief.previous {
+			previousCtx += fmt.Sprintf("  Scene %d: %s\n", i+1, p)
+		}
+		previousCtx += fmt.Sprintf("Now write scene %d. Do NOT repeat what previous scenes already show. Use a different camera move, angle, or setting.\n", sceneNum)
+	}
+	if brief.style != nil {
+		previousCtx += fmt.Sprintf("The ad style is %s: %s\n", brief.style.Name, brief.style.Prompt)
+	}
+	if brief.hint != "" {
+		previousCtx += fmt.Sprintf("Direction for this scene: %s\n", brief.hint)
+	}
+	if brief.rejected != "" {
+		previousCtx += fmt.Sprintf("An earlier prompt for these images was: %q. Take a clearly different creative direction: another camera move, setting, or mood.\n", brief.rejected)
+	}
+
+	userPrompt := fmt.Sprintf(
+		"Write a short video prompt for a %d-second ad scene for %s (shown in the attached images). "+
+			"%s"+
+			"RULES: "+
+			"1-2 sentences MAXIMUM. "+
+			"One camera move, one action. "+
+			"Include: camera move + lighting + mood. "+
+			"Do NOT describe the product appearance. "+
+			"Do NOT use labels like 'Camera:', 'Lighting:', 'Scene:'. "+
+			"Do NOT say the duration. "+
+			"Just write the prompt as a plain sentence. "+
+			"Example: 'Slow orbit around the product on marble surface. Warm rim lighting, soft bokeh. Premium feel.' "+
+			"Output ONLY the prompt.",
+		dur, productCtx, previousCtx,
+	)
+
+	// Build message content: text + all images
+	contentParts := []map[string]interface{}{
+		{
+			"type": "text",
+			"text": userPrompt,
+		},
+	}
+	for _, b64 := range images {
+		contentParts = append(contentParts, map[string]interface{}{
+			"type": "image_url",
+			"image_url": map[string]string{
+				"url": b64,
+			},
+		})
+	}
+
+	fmt.Printf("AutoPrompt%s: Sending %d image(s) to %s (scene %d/%d)...\n", tag, len(images), chatModel, sceneNum, brief.total)
+
+	prompt, usage, err := askModelRunner(chatModel, contentParts)
+	if err != nil {
+		return "", usage, http.StatusInternalServerError, err
+	}
+	prompt = cleanPromptReply(prompt)
+	if prompt == "" {
+		// Vision models sometimes refuse or stop immediately; one nudge
+		// usually gets a prompt out of them
+		fmt.Printf("AutoPrompt%s: Empty response, retrying once\n", tag)
+		nudge := append(contentParts, map[string]interface{}{
+			"type": "text",
+			"text": "Your previous reply was empty. Reply with the video prompt sentence only.",
+		})
+		retry, more, err := askModelRunner(chatModel, nudge)
+		usage.add(more)
+		if err != nil {
+			return "", usage, http.StatusInternalServerError, err
+		}
+		prompt = cleanPromptReply(retry)
+	}
+	if prompt == "" {
+		return "", usage, http.StatusBadGateway, errors.New("The model returned an empty prompt. Try again or write the prompt manually.")
+	}
+	fmt.Printf("AutoPrompt%s: Generated → %s (%d tokens)\n", tag, prompt, usage.TotalTokens)
+	return prompt, usage, http.StatusOK, nil
+}
+
+// tokenUsage is the OpenAI-style usage block of a Model Runner reply.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *tokenUsage) add(o tokenUsage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// askModelRunner sends one user message to a Model Runner model and
+// returns the first choice's content, trimmed, with the tokens it used.
+func askModelRunner(model string, contentParts []map[string]interface{}) (string, tokenUsage, error) {
+	chatPayload := map[string]interface{}{
+		"model": model,
+		"messages": []map[string]interface{}{
+			{
+				"role":    "user",
+				"content": contentParts,
+			},
+		},
+		"max_tokens": 300,
+	}
+
+	chatBody, _ := json.Marshal(chatPayload)
+	lastModelRunnerUse.Store(time.Now().UnixNano())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	httpReq, _ := http.NewRequest("POST", modelRunnerURL, bytes.NewBuffer(chatBody))
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", tokenUsage{}, fmt.Errorf("Model Runner error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return "", tokenUsage{}, fmt.Errorf("Model Runner %d: %s", resp.StatusCode, string(body))
+	}
+
+	var chatResp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage tokenUsage `json:"usage"`
+	}
+
+	if err := json.Unmarshal(body, &chatResp); err != nil || len(chatResp.Choices) == 0 {
+		return "", tokenUsage{}, errors.New("Failed to parse model response")
+	}
+
+	return strings.TrimSpace(chatResp.Choices[0].Message.Content), chatResp.Usage, nil
+}
+
+func handleGenerate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filenames         []string `json:"filenames"`
+		Images            []string `json:"images"` // data URLs kept in memory; needs INLINE_IMAGES
+		Prompt            string   `json:"prompt"`
+		NegativePrompt    string   `json:"negative_prompt"` // added to the model's and style's
+		Model             string   `json:"model"`
+		Style             string   `json:"style"`
+		Styles            []string `json:"styles"`
+		Ratio             string   `json:"ratio"`
+		ProductName       string   `json:"product_name"`
+		VideoFilename     string   `json:"video_filename"`
+		Prompts           []string `json:"prompts"`
+		Preset            string   `json:"preset"`
+		Duration          int      `json:"duration"`
+		DurationUnit      string   `json:"duration_unit"` // seconds (default) or frames at the model's fps
+		Seed              int64    `json:"seed"`          // 0 picks one; count variants add their index
+		Count             int      `json:"count"`
+		Audio             *bool    `json:"audio"`
+		Fit               string   `json:"fit"`
+		SafeZone          bool     `json:"safe_zone"` // keep padded images inside the platform safe zone
+		BackgroundColor   string   `json:"background_color"`
+		RemoveBackground  bool     `json:"remove_background"` // cut the product out before generating
+		BlurBackground    bool     `json:"blur_background"`   // blur the surroundings, keeping the product sharp
+		Priority          string   `json:"priority"`
+		TextToVideo       bool     `json:"text_to_video"`
+		Preview           bool     `json:"preview"`
+		ProjectID         string   `json:"project_id"`
+		ThumbnailFilename string   `json:"thumbnail_filename"`
+		Tags              []string `json:"tags"`
+		Note              string   `json:"note"`
+
+		// Prompt experiment this generation belongs to, for /api/experiments
+		Experiment string `json:"experiment"`
+		Variant    string `json:"variant"`
+
+		// POSTed the job's status when it finishes, with the auth value as
+		// its Authorization header
+		CallbackURL        string `json:"callback_url"`
+		CallbackAuthHeader string `json:"callback_auth_header"`
+
+		// Explicit frame anchors; filenames fill whichever is left unset
+		FirstFrameFilename string `json:"first_frame_filename"`
+		LastFrameFilename  string `json:"last_frame_filename"`
+
+		// Close on the first product image, whatever else is sent
+		EndOnProduct bool `json:"end_on_product"`
+
+		// PNG the size of the first frame; white is kept, black is animated
+		MaskFilename string `json:"mask_filename"`
+
+		// On-screen captions: "srt" sidecar or "burn" into the video
+		Captions  string `json:"captions"`
+		Narration string `json:"narration"`
+
+		// Extra delivery encoding, e.g. "mp4-h265"; the original mp4 is kept
+		OutputFormat string `json:"output_format"`
+
+		// Runware endpoint from RUNWARE_REGIONS, e.g. "eu"
+		Region string `json:"region"`
+
+		// Saved prompt template and its placeholder values
+		TemplateID   string            `json:"template_id"`
+		TemplateVars map[string]string `json:"template_vars"`
+
+		// Structured direction from /api/creative-options, added after the prompt
+		Camera   string `json:"camera"`
+		Lighting string `json:"lighting"`
+		Mood     string `json:"mood"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	// ?mock=true runs this request through mockGenerate, for frontend work
+	// and integration tests against a live-configured server
+	mock := r.URL.Query().Get("mock") == "true"
+	if mock && !allowMockOverride {
+		jsonError(w, "Mock override is disabled (set ALLOW_MOCK_OVERRIDE=true)", http.StatusForbidden)
+		return
+	}
+
+	// A preset's duration is in seconds; the unit only applies to one given
+	// in the request
+	unit := req.DurationUnit
+	if unit == "" {
+		unit = durationSeconds
+	}
+	if unit != durationSeconds && unit != durationFrames {
+		jsonError(w, "duration_unit must be seconds or frames", http.StatusBadRequest)
+		return
+	}
+	if unit == durationFrames && req.Duration == 0 {
+		jsonError(w, "duration_unit=frames needs a duration", http.StatusBadRequest)
+		return
+	}
+
+	// Resolve preset, style and model against one registry snapshot
+	reg := snapshot()
+
+	// A preset fills in whatever the request leaves unset
+	if req.Preset != "" {
+		preset, ok := reg.preset(req.Preset)
+		if !ok {
+			jsonError(w, fmt.Sprintf("Unknown preset: %s", req.Preset), http.StatusBadRequest)
+			return
+		}
+		if req.Style == "" {
+			req.Style = preset.Style
+		}
+		if req.Ratio == "" {
+			req.Ratio = preset.Ratio
+		}
+		if req.Duration == 0 {
+			req.Duration = preset.Duration
+		}
+		if req.Count == 0 {
+			req.Count = preset.Count
+		}
+		if req.Audio == nil {
+			req.Audio = preset.Audio
+		}
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = defaultDuration
+	}
+	if unit == durationSeconds && (duration < 1 || duration > maxDuration) {
+		jsonError(w, fmt.Sprintf("duration must be 1-%d seconds", maxDuration), http.StatusBadRequest)
+		return
+	}
+	if duration < 1 {
+		jsonError(w, "duration must be at least 1 frame", http.StatusBadRequest)
+		return
+	}
+
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 1 || count > maxCount {
+		jsonError(w, fmt.Sprintf("count must be 1-%d", maxCount), http.StatusBadRequest)
+		return
+	}
+	if err := checkSeed(req.Seed); err != nil || req.Seed+int64(count-1) > maxSeed {
+		jsonError(w, fmt.Sprintf("seed must be 1-%d, or 0 for a random one", maxSeed-count+1), http.StatusBadRequest)
+		return
+	}
+
+	audio := true
+	if req.Audio != nil {
+		audio = *req.Audio
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = "normal"
+	}
+	if _, ok := priorityRanks[priority]; !ok {
+		jsonError(w, "priority must be one of: low, normal, high", http.StatusBadRequest)
+		return
+	}
+
+	if req.ProjectID != "" && !projectPattern.MatchString(req.ProjectID) {
+		jsonError(w, fmt.Sprintf("invalid project_id %q", req.ProjectID), http.StatusBadRequest)
+		return
+	}
+	tags, err := cleanTags(req.Tags)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	note, err := cleanNote(req.Note)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkExperiment(req.Experiment, req.Variant); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkCallback(req.CallbackURL, req.CallbackAuthHeader); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validCaptions[req.Captions] {
+		jsonError(w, "captions must be one of: srt, burn", http.StatusBadRequest)
+		return
+	}
+	if req.Captions != "" && !storeVideosLocally {
+		jsonError(w, "captions need a local copy of the video; they are unavailable with STORE_VIDEOS_LOCALLY=false", http.StatusBadRequest)
+		return
+	}
+	if err := checkOutputFormat(req.OutputFormat); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkRegion(req.Region); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	narration := sanitizePrompt(req.Narration)
+	if len(narration) > maxPromptLength {
+		jsonError(w, fmt.Sprintf("narration exceeds %d characters", maxPromptLength), http.StatusBadRequest)
+		return
+	}
+	negative := sanitizePrompt(req.NegativePrompt)
+	if len(negative) > maxPromptLength {
+		jsonError(w, fmt.Sprintf("negative_prompt exceeds %d characters", maxPromptLength), http.StatusBadRequest)
+		return
+	}
+
+	fit := req.Fit
+	if fit == "" {
+		fit = fitNone
+		if req.SafeZone {
+			fit = fitPad
+		}
+	}
+	if !validFits[fit] {
+		jsonError(w, "fit must be one of: pad, crop, none", http.StatusBadRequest)
+		return
+	}
+	if req.SafeZone && fit != fitPad {
+		jsonError(w, "safe_zone only works with fit=pad", http.StatusBadRequest)
+		return
+	}
+	var background string
+	if req.BackgroundColor != "" {
+		bg, err := backgroundColor(req.BackgroundColor)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		background = hexColor(bg)
+	}
+
+	if req.BlurBackground && req.RemoveBackground {
+		jsonError(w, "blur_background cannot be combined with remove_background", http.StatusBadRequest)
+		return
+	}
+
+	// Inline images stand in for uploads and never touch the disk
+	var inline []inlineImage
+	if req.Images != nil {
+		if !inlineImages {
+			jsonError(w, "Inline images are disabled (set INLINE_IMAGES=true)", http.StatusForbidden)
+			return
+		}
+		if len(req.Filenames) > 0 || req.FirstFrameFilename != "" || req.LastFrameFilename != "" || req.TextToVideo {
+			jsonError(w, "images cannot be combined with filenames, frame filenames or text_to_video", http.StatusBadRequest)
+			return
+		}
+		if req.RemoveBackground || req.BlurBackground || req.MaskFilename != "" {
+			jsonError(w, "remove_background, blur_background and mask_filename need uploaded images, not inline ones", http.StatusBadRequest)
+			return
+		}
+		if inline, err = parseInlineImages(req.Images); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	hasFrames := req.FirstFrameFilename != "" || req.LastFrameFilename != ""
+	if req.TextToVideo && (len(req.Filenames) > 0 || hasFrames) {
+		jsonError(w, "text_to_video cannot be combined with filenames", http.StatusBadRequest)
+		return
+	}
+	if len(req.Filenames) == 0 && !hasFrames && inline == nil && req.VideoFilename == "" && !req.TextToVideo {
+		jsonError(w, "filenames is required (or set text_to_video)", http.StatusBadRequest)
+		return
+	}
+
+	// A style brings its own model and base prompt; an explicit model
+	// overrides the style's default. styles[] renders the same inputs once
+	// per style, each on its own model
+	styleIDs := []string{req.Style}
+	if req.Styles != nil {
+		if req.Style != "" || req.Prompts != nil {
+			jsonError(w, "styles cannot be combined with style or prompts", http.StatusBadRequest)
+			return
+		}
+		if styleIDs, err = cleanStyles(req.Styles); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if rejectDisabledStyles(w, reg, styleIDs...) {
+		return
+	}
+	targets, err := resolveTargets(reg, styleIDs, req.Model)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Each model gets the duration in its own seconds: a requested one must
+	// be within its range, the default is fitted into it. A preview renders
+	// the model's shortest clip without audio, at its smallest size (see
+	// frameSize); promoting it later re-runs at the requested duration
+	for i := range targets {
+		m := targets[i].model
+		seconds := min(max(duration, m.shortestDuration()), m.longestDuration())
+		if req.Duration != 0 {
+			if seconds, err = m.resolveDuration(duration, unit); err != nil {
+				jsonError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		targets[i].fullDur = seconds
+		targets[i].duration = seconds
+		if req.Preview {
+			targets[i].duration = targets[i].model.shortestDuration()
+		}
+	}
+
+	// Validate images exist
+	var imagePaths []string
+	for _, fn := range req.Filenames {
+		p, err := resolveUpload(fn)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Image not found: %s", fn), http.StatusBadRequest)
+			return
+		}
+		if isVideoPath(p) {
+			jsonError(w, fmt.Sprintf("%s is a video; filenames takes images", fn), http.StatusBadRequest)
+			return
+		}
+		imagePaths = append(imagePaths, p)
+	}
+
+	var firstFrame, lastFrame string
+	if req.FirstFrameFilename != "" {
+		p, err := resolveUpload(req.FirstFrameFilename)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("First frame not found: %s", req.FirstFrameFilename), http.StatusBadRequest)
+			return
+		}
+		if isVideoPath(p) {
+			jsonError(w, fmt.Sprintf("First frame %s is a video, not an image", req.FirstFrameFilename), http.StatusBadRequest)
+			return
+		}
+		firstFrame = p
+	}
+	if req.LastFrameFilename != "" {
+		if m, ok := lacking(targets, func(c ModelCaps) bool { return c.LastFrame }); ok {
+			jsonError(w, fmt.Sprintf("Model %s does not support a last frame", m.Alias), http.StatusBadRequest)
+			return
+		}
+		p, err := resolveUpload(req.LastFrameFilename)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Last frame not found: %s", req.LastFrameFilename), http.StatusBadRequest)
+			return
+		}
+		if isVideoPath(p) {
+			jsonError(w, fmt.Sprintf("Last frame %s is a video, not an image", req.LastFrameFilename), http.StatusBadRequest)
+			return
+		}
+		lastFrame = p
+	}
+	if req.EndOnProduct {
+		if lastFrame != "" {
+			jsonError(w, "end_on_product cannot be combined with last_frame_filename", http.StatusBadRequest)
+			return
+		}
+		if len(imagePaths) == 0 && inline == nil {
+			jsonError(w, "end_on_product needs a product image in filenames or images", http.StatusBadRequest)
+			return
+		}
+		if m, ok := lacking(targets, func(c ModelCaps) bool { return c.LastFrame }); ok {
+			jsonError(w, fmt.Sprintf("Model %s does not support a last frame", m.Alias), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Some styles only work with a certain number of inputs
+	imageCount := len(imagePaths) + len(inline)
+	for _, p := range []string{firstFrame, lastFrame} {
+		if p != "" {
+			imageCount++
+		}
+	}
+	for _, t := range targets {
+		if t.style == nil {
+			continue
+		}
+		if err := t.style.checkImages(imageCount); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional mask over the first frame for models that support one
+	var maskPath string
+	if req.MaskFilename != "" {
+		if m, ok := lacking(targets, func(c ModelCaps) bool { return c.Mask }); ok {
+			jsonError(w, fmt.Sprintf("Model %s does not support masks", m.Alias), http.StatusBadRequest)
+			return
+		}
+		source := firstFrame
+		if source == "" && len(imagePaths) > 0 {
+			source = imagePaths[0]
+		}
+		if source == "" || req.TextToVideo {
+			jsonError(w, "mask_filename needs a source image to cover", http.StatusBadRequest)
+			return
+		}
+		p, err := resolveUpload(req.MaskFilename)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Mask not found: %s", req.MaskFilename), http.StatusBadRequest)
+			return
+		}
+		if err := checkMask(p, source); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		maskPath = p
+		// Falling back to a model that ignores the mask would lose the product
+		for i, t := range targets {
+			if t.fallback != nil && !t.fallback.Caps.Mask {
+				targets[i].fallback = nil
+			}
+		}
+	}
+
+	mode := "image-to-video"
+	if req.TextToVideo {
+		if m, ok := lacking(targets, func(c ModelCaps) bool { return c.TextToVideo }); ok {
+			jsonError(w, fmt.Sprintf("Model %s does not support text-to-video", m.Alias), http.StatusBadRequest)
+			return
+		}
+		mode = "text-to-video"
+	}
+
+	// Optional input video for video-to-video models
+	var videoPath string
+	if req.VideoFilename != "" {
+		if m, ok := lacking(targets, func(c ModelCaps) bool { return c.VideoInput }); ok {
+			jsonError(w, fmt.Sprintf("Model %s does not support video input", m.Alias), http.StatusBadRequest)
+			return
+		}
+		p, err := resolveUpload(req.VideoFilename)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Video not found: %s", req.VideoFilename), http.StatusBadRequest)
+			return
+		}
+		if !isVideoPath(p) {
+			jsonError(w, fmt.Sprintf("%s is not a video; video_filename takes an .mp4, .mov or .webm upload", req.VideoFilename), http.StatusBadRequest)
+			return
+		}
+		videoPath = p
+		mode = "video-to-video"
+	}
+
+	// Optional hero image shown in the gallery instead of a video frame
+	var thumbPath, thumbURL string
+	if req.ThumbnailFilename != "" {
+		p, err := resolveUpload(req.ThumbnailFilename)
+		if err != nil || isVideoPath(p) {
+			jsonError(w, fmt.Sprintf("Thumbnail image not found: %s", req.ThumbnailFilename), http.StatusBadRequest)
+			return
+		}
+		thumbPath = p
+		thumbURL = fmt.Sprintf("http://localhost:8080/uploads/%s", req.ThumbnailFilename)
+		if name, ok := strings.CutPrefix(req.ThumbnailFilename, samplePrefix); ok {
+			thumbURL = fmt.Sprintf("http://localhost:8080/samples/%s", name)
+		}
+	}
+
+	// A saved template stands in for the free-text prompt
+	if req.TemplateID != "" {
+		if req.Prompt != "" || req.Prompts != nil {
+			jsonError(w, "template_id cannot be combined with prompt or prompts", http.StatusBadRequest)
+			return
+		}
+		tmpl, ok := lookupTemplate(req.TemplateID)
+		if !ok {
+			jsonError(w, fmt.Sprintf("Unknown template: %s", req.TemplateID), http.StatusBadRequest)
+			return
+		}
+		vars := map[string]string{"product": req.ProductName}
+		for k, v := range req.TemplateVars {
+			vars[k] = v
+		}
+		text, err := tmpl.render(vars)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Values can make a short template long
+		if len(sanitizePrompt(text)) > maxPromptLength {
+			jsonError(w, fmt.Sprintf("template %s with these template_vars exceeds %d characters", tmpl.ID, maxPromptLength), http.StatusBadRequest)
+			return
+		}
+		req.Prompt = text
+	}
+
+	var creative *CreativeChoice
+	var direction string
+	if req.Camera != "" || req.Lighting != "" || req.Mood != "" {
+		creative = &CreativeChoice{Camera: req.Camera, Lighting: req.Lighting, Mood: req.Mood}
+		d, err := creative.direction()
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		direction = d
+	}
+
+	// One job per creative direction; a plain prompt is a single direction
+	userPrompts := []string{sanitizePrompt(req.Prompt)}
+	if len(userPrompts[0]) > maxPromptLength {
+		jsonError(w, fmt.Sprintf("prompt exceeds %d characters", maxPromptLength), http.StatusBadRequest)
+		return
+	}
+	if req.Prompts != nil {
+		if len(req.Prompts) == 0 {
+			jsonError(w, "prompts must not be empty when provided", http.StatusBadRequest)
+			return
+		}
+		if len(req.Prompts) > maxPromptVariations {
+			jsonError(w, fmt.Sprintf("At most %d prompts per request", maxPromptVariations), http.StatusBadRequest)
+			return
+		}
+		userPrompts = userPrompts[:0]
+		for i, p := range req.Prompts {
+			p = sanitizePrompt(p)
+			if p == "" {
+				jsonError(w, fmt.Sprintf("prompts[%d] is empty", i), http.StatusBadRequest)
+				return
+			}
+			if len(p) > maxPromptLength {
+				jsonError(w, fmt.Sprintf("prompts[%d] exceeds %d characters", i, maxPromptLength), http.StatusBadRequest)
+				return
+			}
+			userPrompts = append(userPrompts, p)
+		}
+	}
+
+	// An explicit ratio applies to every style; otherwise each style renders
+	// at its recommended one
+	for i, t := range targets {
+		targets[i].ratio = req.Ratio
+		if _, ok := ratioSizes[req.Ratio]; !ok {
+			targets[i].ratio = t.recommendedRatio()
+		}
+	}
+
+	wait, err := generateWait(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	perTarget := len(userPrompts) * count
+	groupID := ""
+	if len(targets)*perTarget > 1 {
+		if wait > 0 {
+			jsonError(w, "wait only works for a single video; drop count, prompts and styles", http.StatusBadRequest)
+			return
+		}
+		groupID = uuid.New().String()[:12]
+	}
+
+	var created []*Job
+	for i := 0; i < len(targets)*perTarget; i++ {
+		t := targets[i/perTarget]
+		p := userPrompts[i%perTarget/count]
+		prompt := buildPrompt(t.style, p, req.ProductName)
+		if direction != "" {
+			prompt = creativePrompt(t.style, p, req.ProductName, direction)
+		}
+		job := &Job{
+			Prompt:         prompt,
+			NegativePrompt: negativePrompt(t.model, t.style, negative),
+			Product:        req.ProductName,
+			Model:          t.model.Name,
+			Style:          t.styleID(),
+			Ratio:          t.ratio,
+			Duration:       t.duration,
+			Fit:            fit,
+			SafeZone:       req.SafeZone,
+			Background:     background,
+			Cutout:         req.RemoveBackground,
+			Blur:           req.BlurBackground,
+			EndOnProduct:   req.EndOnProduct,
+			Priority:       priority,
+			GroupID:        groupID,
+			Project:        req.ProjectID,
+			Note:           note,
+			Tags:           tags,
+			Experiment:     req.Experiment,
+			Variant:        req.Variant,
+			RequestID:      requestID(r.Context()),
+			AppVersion:     appVersion(r.Context()),
+			Preview:        req.Preview,
+			Mode:           mode,
+			Mock:           mock,
+			ThumbnailURL:   thumbURL,
+			Captions:       req.Captions,
+			OutputFormat:   req.OutputFormat,
+			Region:         req.Region,
+			Creative:       creative,
+			InlineImages:   len(inline),
+			imagePaths:     imagePaths,
+			inline:         inline,
+			videoPath:      videoPath,
+			thumbPath:      thumbPath,
+			firstFrame:     firstFrame,
+			lastFrame:      lastFrame,
+			maskPath:       maskPath,
+			callbackURL:    req.CallbackURL,
+			callbackAuth:   req.CallbackAuthHeader,
+			narration:      narration,
+			model:          t.model,
+			fallback:       t.fallback,
+			fullDur:        t.fullDur,
+			audio:          audio,
+		}
+		if req.Duration != 0 {
+			job.RequestedDuration, job.DurationUnit = duration, unit
+		}
+		// Variants of one prompt differ by seed; styles and prompts share it
+		if req.Seed != 0 {
+			job.Seed = req.Seed + int64(i%count)
+		}
+		submitJob(job)
+		created = append(created, job)
+	}
+
+	if wait > 0 {
+		if waitForJob(r.Context(), created[0], wait) {
+			writeSyncResult(w, created[0])
+		}
+		return
+	}
+
+	// Styles render in parallel, so the slowest model sets the estimate
+	eta := 0
+	for _, t := range targets {
+		if secs, _ := estimateSeconds(t.model); secs > eta {
+			eta = secs
+		}
+	}
+	resp := map[string]interface{}{
+		"job_id":            created[0].ID,
+		"status":            "queued",
+		"model":             targets[0].model.Alias,
+		"message":           "Video generation queued",
+		"estimated_seconds": eta,
+	}
+	if groupID != "" {
+		mapping := make([]map[string]string, 0, len(created))
+		for _, job := range created {
+			entry := map[string]string{"job_id": job.ID, "prompt": job.Prompt}
+			if req.Styles != nil {
+				entry["style"] = job.Style
+				entry["model"] = job.model.Alias
+				entry["ratio"] = job.Ratio
+			}
+			mapping = append(mapping, entry)
+		}
+		resp["group_id"] = groupID
+		resp["jobs"] = mapping
+		resp["message"] = fmt.Sprintf("%d video generations queued", len(created))
+	}
+	if req.Styles != nil {
+		byStyle := make(map[string][]string, len(targets))
+		for _, job := range created {
+			byStyle[job.Style] = append(byStyle[job.Style], job.ID)
+		}
+		resp["styles"] = byStyle
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// submitJob assigns an ID, registers the job and queues it for a worker.
+func submitJob(job *Job) {
+	// handlePromote picks the ID up front to claim the preview
+	if job.ID == "" {
+		job.ID = uuid.New().String()[:12]
+	}
+	job.Status = "queued"
+	job.CreatedAt = timestamp()
+	if job.Seed == 0 {
+		job.Seed = newSeed()
+	}
+	newJobContext(job)
+
+	jobsMu.Lock()
+	jobs[job.ID] = job
+	indexGroup(job)
+	jobsMu.Unlock()
+
+	jobLogf(job, levelInfo, "Queued")
+	saveJobs()
+	emitJobEvent(job, eventCreated, nil)
+	queue.push(job)
+}
+
+// handleTryStyle runs one cheap generation of a style against one image:
+// the model's shortest duration, the smallest frame, no audio.
+func handleTryStyle(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filename    string `json:"filename"`
+		Style       string `json:"style"`
+		Prompt      string `json:"prompt"`
+		ProductName string `json:"product_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	reg := snapshot()
+	style, ok := reg.style(req.Style)
+	if !ok {
+		jsonError(w, fmt.Sprintf("Unknown style: %s", req.Style), http.StatusBadRequest)
+		return
+	}
+	if rejectDisabledStyles(w, reg, style.ID) {
+		return
+	}
+	model, ok := reg.model(style.Model)
+	if !ok {
+		jsonError(w, fmt.Sprintf("Unknown model: %s", style.Model), http.StatusBadRequest)
+		return
+	}
+
+	if err := style.checkImages(1); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imgPath, err := resolveUpload(req.Filename)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Image not found: %s", req.Filename), http.StatusBadRequest)
+		return
+	}
+	if isVideoPath(imgPath) {
+		jsonError(w, fmt.Sprintf("%s is a video; a style trial takes an image", req.Filename), http.StatusBadRequest)
+		return
+	}
+	userPrompt := sanitizePrompt(req.Prompt)
+	if len(userPrompt) > maxPromptLength {
+		jsonError(w, fmt.Sprintf("prompt exceeds %d characters", maxPromptLength), http.StatusBadRequest)
+		return
+	}
+
+	duration := model.shortestDuration()
+
+	job := &Job{
+		Prompt:         buildPrompt(style, userPrompt, req.ProductName),
+		NegativePrompt: negativePrompt(model, style, ""),
+		Product:        req.ProductName,
+		Model:          model.Name,
+		Style:          style.ID,
+		Ratio:          "1:1",
+		Duration:       duration,
+		Fit:            fitNone,
+		Mode:           "image-to-video",
+		Trial:          true,
+		Priority:       "normal",
+		RequestID:      requestID(r.Context()),
+		AppVersion:     appVersion(r.Context()),
+		imagePaths:     []string{imgPath},
+		model:          model,
+		audio:          false,
+	}
+	submitJob(job)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":   job.ID,
+		"status":   "queued",
+		"style":    style.ID,
+		"model":    model.Alias,
+		"ratio":    job.Ratio,
+		"duration": job.Duration,
+		"price":    model.costFor(job.Duration),
+		"message":  "Style trial queued",
+	})
+}
+
+// sanitizePrompt trims a user prompt and replaces control characters with
+// spaces so they can't corrupt the provider payload or logs.
+func sanitizePrompt(p string) string {
+	p = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, p)
+	return strings.TrimSpace(p)
+}
+
+// buildPrompt combines the style's base prompt with the user's prompt. With
+// neither, it falls back to a generic commercial prompt.
+func buildPrompt(style *StyleConfig, userPrompt, productName string) string {
+	product := "a product"
+	if productName != "" {
+		product = productName
+	}
+
+	if style != nil {
+		if userPrompt != "" {
+			return style.Prompt + " " + userPrompt
+		}
+		return fmt.Sprintf("%s Featuring %s.", style.Prompt, product)
+	}
+
+	if userPrompt != "" {
+		return userPrompt
+	}
+	return fmt.Sprintf("Commercial advertisement for %s. Slow orbit, dramatic lighting, premium aesthetic. Sharp focus.", product)
+}
 
 func mockGenerate(job *Job) {
-	time.Sleep(5 * time.Second)
+	select {
+	case <-time.After(5 * time.Second):
+	case <-job.ctx.Done():
+		return
+	}
 	jobsMu.Lock()
-	defer jobsMu.Unlock()
+	if job.cancelled() {
+		jobsMu.Unlock()
+		return
+	}
 	job.Status = "completed"
 	job.VideoURL = "https://www.w3schools.com/html/mov_bbb.mp4"
+	job.VideoURLs = []string{job.VideoURL}
+	markFinished(job)
+	jobsMu.Unlock()
+	saveJobs()
+	emitJobEvent(job, eventCompleted, nil)
 }
 
-func runwareGenerate(job *Job) {
-	fmt.Printf("Job %s: Model=%s Images=%d\n", job.ID, job.Model, len(job.imagePaths))
-	fmt.Printf("Job %s: Prompt=%s\n", job.ID, job.Prompt)
+type inputFrame struct {
+	path     string
+	image    *inlineImage // set instead of path for inline images
+	position string       // "first" or "last"
+}
+
+// inputFrames picks the images sent as frame anchors. Explicit first/last
+// frames win and uploads fill whichever slot is left, so at most two images
+// go to the model. With end_on_product the last slot is always the first
+// product image. inline is the worker's copy of job.inline.
+func inputFrames(job *Job, inline []inlineImage) []inputFrame {
+	if n := len(inline); n > 0 {
+		frames := []inputFrame{{image: &inline[0], position: "first"}}
+		switch {
+		case job.EndOnProduct:
+			frames = append(frames, inputFrame{image: &inline[0], position: "last"})
+		case n > 1:
+			frames = append(frames, inputFrame{image: &inline[n-1], position: "last"})
+		}
+		return frames
+	}
+	first, last := job.firstFrame, job.lastFrame
+	n := len(job.imagePaths)
+	if first == "" && n > 0 {
+		first = job.imagePaths[0]
+	}
+	switch {
+	case job.EndOnProduct && n > 0:
+		last = job.imagePaths[0]
+	case last == "" && (n > 1 || n == 1 && job.firstFrame != ""):
+		last = job.imagePaths[n-1]
+	}
+
+	var frames []inputFrame
+	if first != "" {
+		frames = append(frames, inputFrame{path: first, position: "first"})
+	}
+	if last != "" {
+		frames = append(frames, inputFrame{path: last, position: "last"})
+	}
+	return frames
+}
 
-	// Clamp to max 2 images (first + last)
-	usePaths := job.imagePaths
-	if len(usePaths) > 2 {
-		usePaths = []string{usePaths[0], usePaths[len(usePaths)-1]}
-		fmt.Printf("Job %s: Clamped %d images → 2 (first + last)\n", job.ID, len(job.imagePaths))
+func runwareGenerate(job *Job, inline []inlineImage) {
+	if err := checkRegion(job.Region); err != nil {
+		setJobError(job, fmt.Sprintf("Region %s is no longer configured", job.Region))
+		return
 	}
+	jobLogf(job, levelInfo, "Model=%s Images=%d", job.Model, len(job.imagePaths)+job.InlineImages)
+	jobLogf(job, levelInfo, "Prompt=%s", job.Prompt)
 
 	// Build frameImages
+	frames := inputFrames(job, inline)
+	if len(job.imagePaths) > len(frames) {
+		jobLogf(job, levelInfo, "Clamped %d images → %d (first + last)", len(job.imagePaths), len(frames))
+	}
 	var frameImages []map[string]interface{}
-	for i, imgPath := range usePaths {
-		imageData, err := os.ReadFile(imgPath)
-		if err != nil {
-			setJobError(job, fmt.Sprintf("Failed to read image %d: %v", i+1, err))
-			return
+	for i, f := range frames {
+		// Blurring is for privacy, so a failure stops the job rather than
+		// sending the surroundings as they are
+		if job.Blur && f.image == nil {
+			p, err := blurBackground(job, f.path)
+			if err != nil {
+				setJobError(job, fmt.Sprintf("Failed to blur the background of image %d: %v", i+1, err))
+				return
+			}
+			f.path = p
 		}
-
-		ext := filepath.Ext(imgPath)
-		mediaType := "image/jpeg"
-		switch ext {
-		case ".png":
-			mediaType = "image/png"
-		case ".webp":
-			mediaType = "image/webp"
+		// A cutout is optional polish; without one the original is used
+		usedCutout := false
+		if job.Cutout && f.image == nil {
+			if p, err := cutout(job, f.path); err != nil {
+				jobLogf(job, levelWarn, "Background removal skipped for image %d: %v", i+1, err)
+			} else {
+				f.path, usedCutout = p, true
+			}
 		}
 
-		imageBase64 := fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(imageData))
-
-		frame := map[string]interface{}{
-			"inputImage": imageBase64,
+		var imageData []byte
+		var mediaType string
+		if f.image != nil {
+			imageData, mediaType = f.image.data, f.image.mediaType
+		} else {
+			data, err := os.ReadFile(f.path)
+			if err != nil {
+				setJobError(job, fmt.Sprintf("Failed to read image %d: %v", i+1, err))
+				return
+			}
+			imageData, mediaType = data, imageMediaType(f.path, data)
 		}
-
-		if len(usePaths) == 1 {
-			frame["frame"] = "first"
-		} else if i == 0 {
-			frame["frame"] = "first"
-		} else if i == len(usePaths)-1 {
-			frame["frame"] = "last"
+		// Cutouts are flattened onto the background color even with fit=none
+		if job.Fit == fitPad || job.Fit == fitCrop || usedCutout {
+			size := frameSize(job)
+			var safe *safeInsets
+			if z, ok := safeZones[job.Ratio]; ok && job.SafeZone {
+				safe = &z
+			}
+			bg, _ := backgroundColor(job.Background)
+			fitted, err := fitImageData(imageData, size[0], size[1], job.Fit, safe, bg)
+			if err != nil {
+				jobLogf(job, levelWarn, "Could not %s image %d (%v), sending as-is", job.Fit, i+1, err)
+			} else {
+				imageData = fitted
+				mediaType = "image/jpeg"
+			}
 		}
+		imageBase64 := fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(imageData))
 
-		frameImages = append(frameImages, frame)
+		frameImages = append(frameImages, map[string]interface{}{
+			"inputImage": imageBase64,
+			"frame":      f.position,
+		})
 	}
 
-	// Get dimensions from ratio
-	size := ratioSizes[job.Ratio]
-	if size == [2]int{} {
-		size = ratioSizes["9:16"]
-	}
+	size := frameSize(job)
 
 	taskUUID := uuid.New().String()
 
@@ -502,7 +2270,7 @@ func runwareGenerate(job *Job) {
 		"taskType":       "videoInference",
 		"taskUUID":       taskUUID,
 		"positivePrompt": job.Prompt,
-		"model":          job.modelID,
+		"model":          job.model.ID,
 		"width":          size[0],
 		"height":         size[1],
 		"duration":       job.Duration,
@@ -511,55 +2279,79 @@ func runwareGenerate(job *Job) {
 		"numberResults":  1,
 		"includeCost":    true,
 		"outputQuality":  85,
-		"frameImages":    frameImages,
 	}
-
-	// Model-specific provider settings
-	switch {
-	case strings.HasPrefix(job.modelID, "google:"):
-		payload["fps"] = 24
-		payload["providerSettings"] = map[string]interface{}{
-			"google": map[string]interface{}{
-				"generateAudio": true,
-				"enhancePrompt": true,
-			},
+	if job.NegativePrompt != "" {
+		payload["negativePrompt"] = job.NegativePrompt
+	}
+	// Jobs stored before seeds were recorded have none
+	if job.Seed != 0 {
+		payload["seed"] = job.Seed
+	}
+	// Text-to-video jobs have no frames and rely on positivePrompt alone
+	if len(frameImages) > 0 {
+		payload["frameImages"] = frameImages
+	}
+	if job.maskPath != "" {
+		mask, err := maskDataURL(job)
+		if err != nil {
+			setJobError(job, fmt.Sprintf("Failed to read mask: %v", err))
+			return
 		}
-	case strings.HasPrefix(job.modelID, "vidu:"):
-		payload["providerSettings"] = map[string]interface{}{
-			"vidu": map[string]interface{}{
-				"audio": true,
-			},
+		payload["maskImage"] = mask
+	}
+
+	if job.videoPath != "" {
+		videoData, err := os.ReadFile(job.videoPath)
+		if err != nil {
+			setJobError(job, fmt.Sprintf("Failed to read input video: %v", err))
+			return
 		}
-	case strings.HasPrefix(job.modelID, "pixverse:"):
-		payload["providerSettings"] = map[string]interface{}{
-			"pixverse": map[string]interface{}{
-				"thinking": "auto",
-			},
+		payload["referenceVideos"] = []string{
+			fmt.Sprintf("data:%s;base64,%s", videoTypeForPath(job.videoPath), base64.StdEncoding.EncodeToString(videoData)),
 		}
 	}
 
+	// Model-specific provider settings
+	if job.model.Caps.FPS > 0 {
+		payload["fps"] = job.model.Caps.FPS
+	}
+	if settings := providerSettings(job.model, job.audio && !job.Preview); settings != nil {
+		payload["providerSettings"] = settings
+	}
+
 	reqPayload := []map[string]interface{}{payload}
 	reqBody, _ := json.Marshal(reqPayload)
+	recordDebugRequest(job, reqBody)
 
-	fmt.Printf("Job %s: Calling Runware (%s)...\n", job.ID, job.modelID)
+	jobLogf(job, levelInfo, "Calling Runware (%s → %s)...", job.model.Alias, job.model.ID)
 
 	client := &http.Client{Timeout: 5 * time.Minute}
-	httpReq, _ := http.NewRequest("POST", runwareAPIURL, bytes.NewBuffer(reqBody))
+	httpReq, _ := http.NewRequestWithContext(job.ctx, "POST", job.endpoint(), bytes.NewBuffer(reqBody))
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("Authorization", "Bearer "+runwareAPIKey)
 
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		setJobError(job, fmt.Sprintf("Runware API error: %v", err))
+		failJob(job, categoryProviderOutage, fmt.Sprintf("Runware API error: %v", err))
 		return
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Job %s: Response [%d]: %s\n", job.ID, resp.StatusCode, string(body))
+	jobLogf(job, levelDebug, "Response [%d]: %s", resp.StatusCode, string(body))
+	recordDebugResponse(job, "generate", resp.StatusCode, body)
 
 	if resp.StatusCode != 200 {
-		setJobError(job, fmt.Sprintf("Runware API %d: %s", resp.StatusCode, string(body)))
+		if job.fallback != nil && isModelUnavailable(body) {
+			if lack := fallbackLacks(job, inline); lack != "" {
+				jobLogf(job, levelWarn, "%s unavailable; fallback %s has no %s, not retrying", job.model.Alias, job.fallback.Alias, lack)
+			} else {
+				useFallback(job)
+				runwareGenerate(job, inline)
+				return
+			}
+		}
+		failJob(job, responseCategory(resp.StatusCode, body), fmt.Sprintf("Runware API %d: %s", resp.StatusCode, string(body)))
 		return
 	}
 
@@ -571,27 +2363,119 @@ func runwareGenerate(job *Job) {
 		return
 	}
 
-	// Check for direct video URL
-	for _, result := range response.Data {
-		status, _ := result["status"].(string)
-		if status == "success" {
-			if videoURL, ok := result["videoURL"].(string); ok && videoURL != "" {
-				completeJobWithVideo(job, videoURL)
-				return
-			}
-		}
+	// Check for direct video URLs
+	if urls := resultVideoURLs(response.Data); len(urls) > 0 {
+		recordCost(job, response.Data)
+		completeJobWithVideo(job, urls)
+		return
+	}
+
+	// Async — poll for result. The task is persisted so polling can pick
+	// up again after a restart.
+	jobLogf(job, levelInfo, "Async, polling...")
+	jobsMu.Lock()
+	job.taskUUID = taskUUID
+	jobsMu.Unlock()
+	saveJobs()
+	emitJobEvent(job, eventProgress, map[string]interface{}{"stage": "submitted", "task_uuid": taskUUID})
+	waitForResult(job, taskUUID)
+}
+
+// modelUnavailableCodes are the Runware error codes for a model that can't
+// be used at all. Other errors that merely mention the model, like a
+// duration or size it doesn't take, are the request's fault and a fallback
+// wouldn't fix them.
+var modelUnavailableCodes = map[string]bool{
+	"invalidmodel":         true,
+	"invalidairidentifier": true,
+	"modelnotfound":        true,
+	"modelnotavailable":    true,
+	"modelunavailable":     true,
+	"modeldeprecated":      true,
+	"modeldisabled":        true,
+	"unsupportedmodel":     true,
+}
+
+// isModelUnavailable reports whether a Runware error response says the
+// model itself is gone (deprecated, disabled or unknown) rather than the
+// request being bad.
+func isModelUnavailable(body []byte) bool {
+	var resp struct {
+		Errors []struct {
+			Code string `json:"code"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(body, &resp) != nil {
+		return false
+	}
+	for _, e := range resp.Errors {
+		if modelUnavailableCodes[strings.ToLower(e.Code)] {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackLacks names the first capability the job uses that its fallback
+// model doesn't have, or returns "" when the fallback can take the job.
+func fallbackLacks(job *Job, inline []inlineImage) string {
+	caps := job.fallback.Caps
+	hasLast := false
+	for _, f := range inputFrames(job, inline) {
+		hasLast = hasLast || f.position == "last"
+	}
+	switch {
+	case job.Mode == "text-to-video" && !caps.TextToVideo:
+		return "text-to-video"
+	case hasLast && !caps.LastFrame:
+		return "last frame"
+	case job.videoPath != "" && !caps.VideoInput:
+		return "video input"
+	case job.maskPath != "" && !caps.Mask:
+		return "mask"
+	case job.audio && !job.Preview && job.model.Caps.Audio && !caps.Audio:
+		return "audio"
 	}
+	return ""
+}
 
-	// Async — poll for result
-	fmt.Printf("Job %s: Async, polling...\n", job.ID)
-	pollResult(job, taskUUID)
+// useFallback switches the job to its style's fallback model, keeping the
+// duration within what that model supports. Check fallbackLacks first.
+func useFallback(job *Job) {
+	fb := job.fallback
+	jobsMu.Lock()
+	job.FallbackFrom = job.Model
+	job.Model = fb.Name
+	job.model = fb
+	job.fallback = nil
+	if fb.Caps.MinDuration > 0 && job.Duration < fb.Caps.MinDuration {
+		job.Duration = fb.Caps.MinDuration
+	}
+	if fb.Caps.MaxDuration > 0 && job.Duration > fb.Caps.MaxDuration {
+		job.Duration = fb.Caps.MaxDuration
+	}
+	jobsMu.Unlock()
+	jobLogf(job, levelWarn, "%s unavailable, retrying with fallback %s", job.FallbackFrom, fb.Alias)
+	saveJobs()
+	emitJobEvent(job, eventProgress, map[string]interface{}{"stage": "fallback", "model": fb.Alias})
 }
 
 func pollResult(job *Job, taskUUID string) {
 	client := &http.Client{Timeout: 30 * time.Second}
 
-	for i := 0; i < 120; i++ {
-		time.Sleep(5 * time.Second)
+	delay := job.model.firstPollDelay()
+	for i := 0; i < maxPolls; i++ {
+		if i > 0 {
+			delay = pollInterval
+		}
+		select {
+		case <-time.After(delay):
+		case <-job.ctx.Done():
+			return
+		}
+		if !waitPollResumed(job) {
+			return
+		}
 
 		payload := []map[string]interface{}{
 			{
@@ -601,20 +2485,21 @@ func pollResult(job *Job, taskUUID string) {
 		}
 
 		body, _ := json.Marshal(payload)
-		req, _ := http.NewRequest("POST", runwareAPIURL, bytes.NewBuffer(body))
+		req, _ := http.NewRequestWithContext(job.ctx, "POST", job.endpoint(), bytes.NewBuffer(body))
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+runwareAPIKey)
 
 		resp, err := client.Do(req)
 		if err != nil {
-			fmt.Printf("Job %s: Poll error: %v\n", job.ID, err)
+			jobLogf(job, levelWarn, "Poll error: %v", err)
 			continue
 		}
 
 		respBody, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
 
-		fmt.Printf("Job %s: Poll [%d]: %s\n", job.ID, resp.StatusCode, string(respBody))
+		jobLogf(job, levelDebug, "Poll [%d]: %s", resp.StatusCode, string(respBody))
+		recordDebugResponse(job, "poll", resp.StatusCode, respBody)
 
 		var pollResp struct {
 			Data   []map[string]interface{} `json:"data"`
@@ -624,73 +2509,270 @@ func pollResult(job *Job, taskUUID string) {
 			continue
 		}
 
-		for _, e := range pollResp.Errors {
-			if msg, ok := e["message"].(string); ok && msg != "" {
-				setJobError(job, msg)
-				return
-			}
+		if applyPollResponse(job, pollResp.Data, pollResp.Errors, completeJobWithVideo) {
+			return
 		}
+	}
 
-		for _, result := range pollResp.Data {
-			status, _ := result["status"].(string)
+	failJob(job, categoryProviderOutage, "Timed out waiting for video")
+}
 
-			if status == "success" {
-				if videoURL, ok := result["videoURL"].(string); ok && videoURL != "" {
-					completeJobWithVideo(job, videoURL)
-					return
-				}
-			}
+// applyPollResponse finishes the job if a getResponse reply carries a final
+// result or an error, handing finished videos to complete. It reports
+// whether the job is done.
+func applyPollResponse(job *Job, data, errs []map[string]interface{}, complete func(*Job, []string)) bool {
+	for _, e := range errs {
+		if msg, ok := e["message"].(string); ok && msg != "" {
+			failJob(job, categorizeError(e), msg)
+			return true
+		}
+	}
 
-			if status == "error" {
-				errMsg := "Unknown error"
-				if msg, ok := result["message"].(string); ok {
-					errMsg = msg
-				}
-				setJobError(job, errMsg)
-				return
+	if urls := resultVideoURLs(data); len(urls) > 0 {
+		recordCost(job, data)
+		complete(job, urls)
+		return true
+	}
+
+	for _, result := range data {
+		if status, _ := result["status"].(string); status == "error" {
+			errMsg := "Unknown error"
+			if msg, ok := result["message"].(string); ok {
+				errMsg = msg
 			}
+			failJob(job, categorizeError(result), errMsg)
+			return true
 		}
 	}
+	return false
+}
 
-	setJobError(job, "Timed out waiting for video")
+// resultVideoURLs collects the videoURL of every successful result, in the
+// order the provider returned them, skipping duplicates.
+func resultVideoURLs(data []map[string]interface{}) []string {
+	var urls []string
+	for _, result := range data {
+		status, _ := result["status"].(string)
+		videoURL, _ := result["videoURL"].(string)
+		if status == "success" && videoURL != "" && !slices.Contains(urls, videoURL) {
+			urls = append(urls, videoURL)
+		}
+	}
+	return urls
 }
 
-func completeJobWithVideo(job *Job, remoteURL string) {
-	fmt.Printf("Job %s: Done! Downloading %s\n", job.ID, remoteURL)
+// completeJobWithVideo downloads every result of the provider call. The
+// first is the job's primary video and gets captions and the size check;
+// any others are saved alongside it as <id>-2.mp4, <id>-3.mp4 and so on.
+func completeJobWithVideo(job *Job, remoteURLs []string) {
+	if !storeVideosLocally {
+		completeJobRemote(job, remoteURLs)
+		return
+	}
+
+	remoteURL := remoteURLs[0]
+	jobLogf(job, levelInfo, "Done! Downloading %s", remoteURL)
+	emitJobEvent(job, eventProgress, map[string]interface{}{"stage": "downloading"})
 
 	localPath := filepath.Join("videos", job.ID+".mp4")
 	localURL := fmt.Sprintf("http://localhost:8080/videos/%s.mp4", job.ID)
 
-	client := &http.Client{Timeout: 2 * time.Minute}
-	resp, err := client.Get(remoteURL)
+	written, err := downloadWithRetry(job, remoteURL, localPath)
+	if job.cancelled() {
+		// The download was aborted, or finished just before the cancel
+		os.Remove(localPath)
+		jobLogf(job, levelInfo, "Download stopped, job was cancelled")
+		return
+	}
+	if errors.Is(err, errVideoTooLarge) {
+		setJobError(job, fmt.Sprintf("Generated video exceeds the %d MB limit (MAX_VIDEO_MB)", maxVideoMB))
+		return
+	}
 	if err != nil {
-		fmt.Printf("Job %s: Download failed: %v, using remote URL\n", job.ID, err)
+		if !remoteReachable(remoteURL) {
+			setJobError(job, fmt.Sprintf("Video download failed (%v) and the provider URL is no longer reachable", err))
+			return
+		}
+		jobLogf(job, levelWarn, "Download failed: %v, using remote URL", err)
 		localURL = remoteURL
 	} else {
-		defer resp.Body.Close()
-		out, err := os.Create(localPath)
-		if err != nil {
-			fmt.Printf("Job %s: Save failed: %v, using remote URL\n", job.ID, err)
-			localURL = remoteURL
-		} else {
-			written, _ := io.Copy(out, resp.Body)
-			out.Close()
-			fmt.Printf("Job %s: Saved %s (%d bytes)\n", job.ID, localPath, written)
+		jobLogf(job, levelInfo, "Saved %s (%d bytes)", localPath, written)
+	}
+
+	var captionsURL string
+	if job.Captions != "" && localURL != remoteURL {
+		emitJobEvent(job, eventProgress, map[string]interface{}{"stage": "captioning"})
+		if captionsURL, err = addCaptions(job, localPath); err != nil {
+			jobLogf(job, levelWarn, "Captions failed: %v", err)
+		}
+	}
+
+	if videoMetadata && localURL != remoteURL {
+		if err := tagVideo(job, localPath); err != nil {
+			jobLogf(job, levelWarn, "Could not write metadata: %v", err)
 		}
 	}
 
+	var outputURL string
+	if job.OutputFormat != "" && localURL != remoteURL {
+		emitJobEvent(job, eventProgress, map[string]interface{}{"stage": "transcoding"})
+		if outputURL, err = transcodeVideo(job, localPath); err != nil {
+			jobLogf(job, levelWarn, "Transcode to %s failed: %v", job.OutputFormat, err)
+		}
+	}
+
+	// An uploaded thumbnail_filename wins over a frame of the video
+	var thumbURL string
+	var thumbW, thumbH int
+	if job.thumbPath == "" && localURL != remoteURL {
+		if thumbURL, thumbW, thumbH, err = makeThumbnail(job, localPath); err != nil {
+			jobLogf(job, levelWarn, "Thumbnail failed: %v", err)
+		}
+	}
+
+	// Some models snap to their own sizes; flag output that came back
+	// letterboxed or stretched relative to the requested ratio
+	var width, height int
+	if localURL != remoteURL {
+		if width, height, err = probeVideoSize(job.ctx, localPath); err != nil {
+			jobLogf(job, levelWarn, "Could not probe video size: %v", err)
+		}
+	}
+
+	videoURLs := []string{localURL}
+	for i, u := range remoteURLs[1:] {
+		if extra := saveExtraResult(job, i+2, u); extra != "" {
+			videoURLs = append(videoURLs, extra)
+		}
+	}
+	makeVideoRoom(job)
+
+	// A cancel during the steps above already finished the job
 	jobsMu.Lock()
+	if job.cancelled() {
+		jobsMu.Unlock()
+		discardVideos(job)
+		jobLogf(job, levelInfo, "Finished after the job was cancelled, result discarded")
+		return
+	}
 	job.Status = "completed"
 	job.VideoURL = localURL
+	job.VideoURLs = videoURLs
+	job.RemoteVideoURL = remoteURL
+	job.CaptionsURL = captionsURL
+	job.OutputURL = outputURL
+	if thumbURL != "" {
+		job.ThumbnailURL, job.ThumbnailWidth, job.ThumbnailHeight = thumbURL, thumbW, thumbH
+	}
+	if width > 0 {
+		job.Width, job.Height = width, height
+		job.RatioMismatch = ratioMismatch(job.Ratio, width, height)
+	}
+	markFinished(job)
 	jobsMu.Unlock()
+	saveJobs()
+	emitJobEvent(job, eventCompleted, nil)
 }
 
-func setJobError(job *Job, errMsg string) {
+// completeJobRemote finishes a job with STORE_VIDEOS_LOCALLY=false: the
+// provider's URLs are served as they are and nothing is written to disk.
+func completeJobRemote(job *Job, remoteURLs []string) {
+	if job.cancelled() {
+		return
+	}
+	jobLogf(job, levelInfo, "Done! Serving %s from the provider", remoteURLs[0])
+
+	jobsMu.Lock()
+	if job.cancelled() {
+		jobsMu.Unlock()
+		return
+	}
+	job.Status = "completed"
+	job.VideoURL = remoteURLs[0]
+	job.VideoURLs = remoteURLs
+	job.RemoteVideoURL = remoteURLs[0]
+	markFinished(job)
+	jobsMu.Unlock()
+	saveJobs()
+	emitJobEvent(job, eventCompleted, nil)
+}
+
+// saveExtraResult downloads an additional result as <id>-<n>.mp4 and
+// returns the URL to serve it from: the local copy, the provider's URL if
+// only that works, or "" when the result is lost.
+func saveExtraResult(job *Job, n int, remoteURL string) string {
+	name := fmt.Sprintf("%s-%d.mp4", job.ID, n)
+	localPath := filepath.Join("videos", name)
+
+	written, err := downloadWithRetry(job, remoteURL, localPath)
+	if err != nil {
+		if job.cancelled() {
+			return ""
+		}
+		if errors.Is(err, errVideoTooLarge) || !remoteReachable(remoteURL) {
+			jobLogf(job, levelWarn, "Dropping result %d: %v", n, err)
+			return ""
+		}
+		jobLogf(job, levelWarn, "Download of result %d failed: %v, using remote URL", n, err)
+		return remoteURL
+	}
+	jobLogf(job, levelInfo, "Saved %s (%d bytes)", localPath, written)
+
+	if videoMetadata {
+		if err := tagVideo(job, localPath); err != nil {
+			jobLogf(job, levelWarn, "Could not write metadata on result %d: %v", n, err)
+		}
+	}
+	return fmt.Sprintf("http://localhost:8080/videos/%s", name)
+}
+
+// timestamp returns the current time in the RFC3339 UTC form used for every
+// job timestamp.
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// markFinished records when the job reached a terminal state and how long
+// generation took, measured from when a worker picked it up, and lets go
+// of any inline images. Caller holds jobsMu.
+func markFinished(job *Job) {
+	job.inline = nil
+	resumePoll(job)
+	now := time.Now().UTC()
+	job.CompletedAt = now.Format(time.RFC3339)
+
+	if !job.started.IsZero() {
+		job.GenerationSeconds = int(now.Sub(job.started).Round(time.Second) / time.Second)
+	}
+}
+
+func setJobError(job *Job, errMsg string) { failJob(job, "", errMsg) }
+
+// failJob marks the job failed with a category from errorcat.go, or none
+// when the cause isn't one a client can act on.
+func failJob(job *Job, category, errMsg string) {
+	if job.cancelled() {
+		return
+	}
 	jobsMu.Lock()
-	defer jobsMu.Unlock()
+	// handleCancelJob cancels under jobsMu, so this check can't go stale
+	if job.cancelled() {
+		jobsMu.Unlock()
+		return
+	}
 	job.Status = "failed"
 	job.Error = errMsg
-	fmt.Printf("Job %s FAILED: %s\n", job.ID, errMsg)
+	job.ErrorCategory = category
+	markFinished(job)
+	jobsMu.Unlock()
+	if category != "" {
+		fmt.Printf("Job %s FAILED (%s): %s\n", job.logID(), category, errMsg)
+	} else {
+		fmt.Printf("Job %s FAILED: %s\n", job.logID(), errMsg)
+	}
+	recordJobLog(job, levelError, errMsg)
+	saveJobs()
+	emitJobEvent(job, eventFailed, nil)
 }
 
 func handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -704,37 +2786,485 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?wait=N long-polls: hold the request until the status changes
+	if v := r.URL.Query().Get("wait"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			jsonError(w, "wait must be a non-negative number of seconds", http.StatusBadRequest)
+			return
+		}
+		wait := min(time.Duration(secs)*time.Second, maxStatusWait)
+		if !waitForStatusChange(r.Context(), job, wait) {
+			return
+		}
+	}
+
+	jobsMu.RLock()
+	resp := statusFields(job)
+	queued := job.Status == "queued"
+	jobsMu.RUnlock()
+
+	if queued {
+		if pos := queue.position(job); pos >= 0 {
+			resp["queue_position"] = pos
+		}
+	}
+
+	// ?inline=true embeds small videos for clients that can't fetch /videos/
+	if r.URL.Query().Get("inline") == "true" && resp["status"] == "completed" {
+		dataURL, status, err := inlineVideo(job.ID)
+		if err != nil {
+			jsonError(w, err.Error(), status)
+			return
+		}
+		resp["video_data"] = dataURL
+	}
+
+	// The ETag hashes the whole response, so it changes with any state
+	// transition and pollers get a cheap 304 while nothing moves.
+	body, _ := json.Marshal(resp)
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":        job.ID,
-		"status":    job.Status,
-		"video_url": job.VideoURL,
-		"error":     job.Error,
-	})
+	w.Write(append(body, '\n'))
+}
+
+// statusFields is the body of GET /api/status for job. Callers must hold
+// jobsMu.
+func statusFields(job *Job) map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":         job.ID,
+		"status":     job.Status,
+		"priority":   job.Priority,
+		"video_url":  job.VideoURL,
+		"error":      job.Error,
+		"created_at": job.CreatedAt,
+	}
+	if job.ErrorCategory != "" {
+		resp["error_category"] = job.ErrorCategory
+	}
+	if len(job.VideoURLs) > 0 {
+		resp["video_urls"] = job.VideoURLs
+	}
+	// Only worth showing when it differs from what video_url serves
+	if job.RemoteVideoURL != "" && job.RemoteVideoURL != job.VideoURL {
+		resp["remote_video_url"] = job.RemoteVideoURL
+	}
+	if job.CaptionsURL != "" {
+		resp["captions_url"] = job.CaptionsURL
+	}
+	if job.OutputURL != "" {
+		resp["output_url"] = job.OutputURL
+	}
+	if job.PollPaused {
+		resp["poll_paused"] = true
+	}
+	if job.Region != "" {
+		resp["region"] = job.Region
+	}
+	if job.Experiment != "" {
+		resp["experiment"] = job.Experiment
+		resp["variant"] = job.Variant
+	}
+	if job.Rating > 0 {
+		resp["rating"] = job.Rating
+	}
+	if job.Thumbs != "" {
+		resp["thumbs"] = job.Thumbs
+	}
+	if job.StartedAt != "" {
+		resp["started_at"] = job.StartedAt
+	}
+	if job.CompletedAt != "" {
+		resp["completed_at"] = job.CompletedAt
+		resp["generation_seconds"] = job.GenerationSeconds
+	}
+	if job.RequestID != "" {
+		resp["request_id"] = job.RequestID
+	}
+	if job.AppVersion != "" {
+		resp["app_version"] = job.AppVersion
+	}
+	if job.Creative != nil {
+		resp["creative"] = job.Creative
+	}
+	if len(job.Tags) > 0 {
+		resp["tags"] = job.Tags
+	}
+	if job.Note != "" {
+		resp["note"] = job.Note
+	}
+	if job.Preview {
+		resp["preview"] = true
+	}
+	if job.PreviewOf != "" {
+		resp["preview_of"] = job.PreviewOf
+	}
+	if job.Trial {
+		resp["trial"] = true
+	}
+	if job.PromotedTo != "" {
+		resp["promoted_to"] = job.PromotedTo
+	}
+	if job.FallbackFrom != "" {
+		resp["model"] = job.Model
+		resp["fallback_from"] = job.FallbackFrom
+	}
+	if job.Width > 0 {
+		size := frameSize(job)
+		resp["requested_size"] = fmt.Sprintf("%dx%d", size[0], size[1])
+		resp["actual_size"] = fmt.Sprintf("%dx%d", job.Width, job.Height)
+		resp["ratio_mismatch"] = job.RatioMismatch
+	}
+	return resp
+}
+
+// waitForStatusChange blocks until the job leaves its current status or
+// wait elapses. Finished jobs return straight away. It reports false when
+// the client went away, in which case there is nobody to answer.
+func waitForStatusChange(ctx context.Context, job *Job, wait time.Duration) bool {
+	jobsMu.RLock()
+	status := job.Status
+	jobsMu.RUnlock()
+	if jobFinished(status) {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		changed, stop := watchJob(job.ID)
+		// Re-check after subscribing so a change in between isn't missed
+		jobsMu.RLock()
+		current := job.Status
+		jobsMu.RUnlock()
+		if current != status {
+			stop()
+			return true
+		}
+
+		select {
+		case <-changed:
+			// Progress events wake us too; keep waiting unless the status moved
+		case <-timer.C:
+			stop()
+			return true
+		case <-ctx.Done():
+			stop()
+			return false
+		}
+	}
+}
+
+// inlineVideo returns the job's local video as a base64 data URL, or an
+// error with the status to report when it can't be inlined.
+func inlineVideo(id string) (string, int, error) {
+	info, err := os.Stat(filepath.Join("videos", id+".mp4"))
+	if err != nil {
+		return "", http.StatusConflict, errors.New("Video is not stored on this server and can't be inlined")
+	}
+	if info.Size() > maxInlineMB<<20 {
+		return "", http.StatusRequestEntityTooLarge, fmt.Errorf("Video is %.1f MB; inline is limited to %d MB (MAX_INLINE_MB)", float64(info.Size())/(1<<20), maxInlineMB)
+	}
+	data, err := os.ReadFile(filepath.Join("videos", id+".mp4"))
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return "data:video/mp4;base64," + base64.StdEncoding.EncodeToString(data), http.StatusOK, nil
+}
+
+// etagMatches reports whether an If-None-Match header lists etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
 }
 
 func handleListJobs(w http.ResponseWriter, r *http.Request) {
 	jobsMu.RLock()
 	defer jobsMu.RUnlock()
 
+	list := filterJobs(r, listJobs())
+
+	// The list changes with every job transition, so never cache it
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  list,
+		"total": len(list),
+	})
+}
+
+// filterJobs keeps the jobs matching the request's ?project_id= and every
+// ?tag=, filtering list in place. Callers must hold jobsMu.
+func filterJobs(r *http.Request, list []*Job) []*Job {
+	if project := r.URL.Query().Get("project_id"); project != "" {
+		filtered := list[:0]
+		for _, j := range list {
+			if j.Project == project {
+				filtered = append(filtered, j)
+			}
+		}
+		list = filtered
+	}
+	if tags := r.URL.Query()["tag"]; len(tags) > 0 {
+		filtered := list[:0]
+		for _, j := range list {
+			if j.hasTags(tags) {
+				filtered = append(filtered, j)
+			}
+		}
+		list = filtered
+	}
+	return list
+}
+
+// listJobs returns all jobs, newest first. Callers must hold jobsMu.
+func listJobs() []*Job {
 	list := make([]*Job, 0, len(jobs))
 	for _, j := range jobs {
 		list = append(list, j)
 	}
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].CreatedAt > list[k].CreatedAt
+	})
+	return list
+}
+
+// handleListModels lists models and styles with prices for the requested
+// duration (?duration=N, default 4 seconds).
+func handleListModels(w http.ResponseWriter, r *http.Request) {
+	duration, err := durationParam(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	models := []map[string]interface{}{}
+	reg := snapshot()
+	for _, m := range reg.sortedModels() {
+		entry := map[string]interface{}{
+			"alias":    m.Alias,
+			"id":       m.ID,
+			"name":     m.Name,
+			"provider": m.Provider,
+			"caps":     m.Caps,
+			"price":    m.costFor(duration),
+		}
+		if m.NegativePrompt != "" {
+			entry["negative_prompt"] = m.NegativePrompt
+		}
+		models = append(models, entry)
+	}
+
+	styles := []map[string]interface{}{}
+	for _, st := range reg.sortedStyles() {
+		if !styleEnabled(st.ID) {
+			continue
+		}
+		entry := map[string]interface{}{
+			"id":    st.ID,
+			"name":  st.Name,
+			"model": st.Model,
+		}
+		if len(st.Models) > 0 {
+			entry["models"] = st.Models
+		}
+		if st.FallbackModel != "" {
+			entry["fallback_model"] = st.FallbackModel
+		}
+		if st.RecommendedRatio != "" {
+			entry["recommended_ratio"] = st.RecommendedRatio
+		}
+		if st.NegativePrompt != "" {
+			entry["negative_prompt"] = st.NegativePrompt
+		}
+		if st.MinImages > 0 {
+			entry["min_images"] = st.MinImages
+		}
+		if st.MaxImages > 0 {
+			entry["max_images"] = st.MaxImages
+		}
+		if m, ok := reg.model(st.Model); ok {
+			entry["price"] = m.costFor(duration)
+		}
+		styles = append(styles, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"duration":      duration,
+		"models":        models,
+		"styles":        styles,
+		"prompt_models": promptModels,
+		"regions":       regionNames(),
+	})
+}
+
+// handleEstimate prices a generation before it's submitted:
+// ?style= or ?model=, plus optional duration and count.
+func handleEstimate(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	reg := snapshot()
+
+	modelRef := q.Get("model")
+	if id := q.Get("style"); id != "" {
+		st, ok := reg.style(id)
+		if !ok {
+			jsonError(w, fmt.Sprintf("Unknown style: %s", id), http.StatusBadRequest)
+			return
+		}
+		if rejectDisabledStyles(w, reg, id) {
+			return
+		}
+		modelRef = st.Model
+	}
+	model, ok := reg.model(modelRef)
+	if !ok {
+		jsonError(w, fmt.Sprintf("Unknown model: %s", modelRef), http.StatusBadRequest)
+		return
+	}
+
+	duration, err := durationParam(r)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count := 1
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxCount {
+			jsonError(w, fmt.Sprintf("count must be 1-%d", maxCount), http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
 
+	perVideo := model.costFor(duration)
+	eta, source := estimateSeconds(model)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"model":             model.Alias,
+		"duration":          duration,
+		"count":             count,
+		"price_per_video":   perVideo,
+		"total":             math.Round(perVideo*float64(count)*100) / 100,
+		"estimated_seconds": eta,
+		"estimate_source":   source,
+	})
+}
+
+// durationParam reads ?duration=, defaulting to defaultDuration.
+func durationParam(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("duration")
+	if v == "" {
+		return defaultDuration, nil
+	}
+	d, err := strconv.Atoi(v)
+	if err != nil || d < 1 || d > maxDuration {
+		return 0, fmt.Errorf("duration must be 1-%d seconds", maxDuration)
+	}
+	return d, nil
+}
+
+func handleListPresets(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(list)
+	json.NewEncoder(w).Encode(enabledPresets(snapshot().sortedPresets()))
 }
 
+// handleHealth is the liveness check, with an at-a-glance view of the queue.
+// Everything in it is cheap to read and safe to expose.
 func handleHealth(w http.ResponseWriter, r *http.Request) {
+	workers, paused, _, queued, running := queue.settings()
+	processing := 0
+	jobsMu.RLock()
+	for _, j := range jobs {
+		if j.Status == "processing" {
+			processing++
+		}
+	}
+	jobsMu.RUnlock()
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  "ok",
 		"mode":    map[bool]string{true: "MOCK", false: "Runware AI"}[useMock],
 		"has_key": runwareAPIKey != "",
+		"queue": map[string]interface{}{
+			"queued":         queued,
+			"active_workers": running,
+			"worker_count":   workers,
+			"processing":     processing,
+			"paused":         paused,
+		},
 	})
 }
 
+// resolveUpload maps a client-supplied filename to a file in uploads/, or
+// to a bundled sample for "sample:" names, refusing anything that isn't a
+// plain filename.
+func resolveUpload(fn string) (string, error) {
+	if strings.HasPrefix(fn, samplePrefix) {
+		return resolveSample(fn)
+	}
+	project, name := path.Split(fn)
+	if project != "" && !projectPattern.MatchString(strings.TrimSuffix(project, "/")) {
+		return "", fmt.Errorf("invalid filename: %s", fn)
+	}
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid filename: %s", fn)
+	}
+	p := filepath.Join("uploads", project, name)
+	if _, err := os.Stat(p); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// isVideoPath reports whether an upload's extension is one of the accepted
+// video containers.
+func isVideoPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp4", ".mov", ".webm":
+		return true
+	}
+	return false
+}
+
+// mediaTypeForPath maps an upload's extension to its image MIME type.
+func mediaTypeForPath(path string) string {
+	switch filepath.Ext(path) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	}
+	return "image/jpeg"
+}
+
+// videoTypeForPath maps a video's extension to its MIME type.
+func videoTypeForPath(path string) string {
+	switch filepath.Ext(path) {
+	case ".mov":
+		return "video/quicktime"
+	case ".webm":
+		return "video/webm"
+	}
+	return "video/mp4"
+}
+
 func jsonError(w http.ResponseWriter, msg string, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// checkMask validates a mask against the image it covers: a PNG of exactly
+// the same size. White marks the product to keep as-is; black is the area
+// the model may animate.
+func checkMask(maskPath, sourcePath string) error {
+	mask, err := decodeConfig(maskPath)
+	if err != nil {
+		return err
+	}
+	if mask.format != "png" {
+		return fmt.Errorf("mask must be a PNG, got %s", mask.format)
+	}
+	src, err := decodeConfig(sourcePath)
+	if err != nil {
+		return err
+	}
+	if mask.Width != src.Width || mask.Height != src.Height {
+		return fmt.Errorf("mask is %dx%d but the source image is %dx%d", mask.Width, mask.Height, src.Width, src.Height)
+	}
+	return nil
+}
+
+type imageConfig struct {
+	image.Config
+	format string
+}
+
+func decodeConfig(path string) (imageConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return imageConfig{}, err
+	}
+	defer f.Close()
+	cfg, format, err := image.DecodeConfig(f)
+	return imageConfig{cfg, format}, err
+}
+
+// maskDataURL encodes the job's mask for the provider. It goes through the
+// same fit as the first frame so the two still line up; added letterbox bars
+// are black, i.e. free for the model to fill.
+func maskDataURL(job *Job) (string, error) {
+	data, err := os.ReadFile(job.maskPath)
+	if err != nil {
+		return "", err
+	}
+	mediaType := "image/png"
+	if job.Fit == fitPad || job.Fit == fitCrop {
+		size := frameSize(job)
+		var safe *safeInsets
+		if z, ok := safeZones[job.Ratio]; ok && job.SafeZone {
+			safe = &z
+		}
+		if data, err = fitImageData(data, size[0], size[1], job.Fit, safe, color.Black); err != nil {
+			return "", err
+		}
+		mediaType = "image/jpeg"
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mediaType, base64.StdEncoding.EncodeToString(data)), nil
+}
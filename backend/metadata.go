@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// metadataVars are the values METADATA_* templates can use as {name}.
+func metadataVars(job *Job) map[string]string {
+	date, _, _ := strings.Cut(job.CreatedAt, "T")
+	return map[string]string{
+		"product":  job.Product,
+		"prompt":   job.Prompt,
+		"model":    job.Model,
+		"style":    job.Style,
+		"ratio":    job.Ratio,
+		"duration": strconv.Itoa(job.Duration),
+		"job_id":   job.ID,
+		"date":     date,
+	}
+}
+
+// renderMetadata fills {name} placeholders in tmpl. Unknown placeholders
+// are left as written so a typo shows up in the file instead of vanishing.
+func renderMetadata(tmpl string, vars map[string]string) string {
+	return strings.TrimSpace(placeholderPattern.ReplaceAllStringFunc(tmpl, func(m string) string {
+		if v, ok := vars[m[1:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	}))
+}
+
+// tagVideo writes the title, artist and comment tags and the creation time
+// into the mp4 at videoPath. Streams are copied, not re-encoded, and the
+// file is only swapped in once ffmpeg succeeds. Tags that render empty are
+// left out.
+func tagVideo(job *Job, videoPath string) error {
+	vars := metadataVars(job)
+	args := []string{"-y", "-v", "error", "-i", videoPath, "-map", "0", "-c", "copy"}
+	for _, tag := range []struct{ key, tmpl string }{
+		{"title", metadataTitle},
+		{"artist", metadataArtist},
+		{"comment", metadataComment},
+	} {
+		if v := renderMetadata(tag.tmpl, vars); v != "" {
+			args = append(args, "-metadata", tag.key+"="+v)
+		}
+	}
+	if job.CreatedAt != "" {
+		args = append(args, "-metadata", "creation_time="+job.CreatedAt)
+	}
+
+	f, err := createTemp(videoPath)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	tmp := f.Name()
+
+	out, err := exec.CommandContext(job.ctx, ffmpegPath, append(args, tmp)...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return commitTemp(tmp, videoPath)
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ModelCaps lists what a model can do, so handlers can validate a request
+// against the model instead of hardcoding model IDs.
+type ModelCaps struct {
+	TextToVideo bool `json:"text_to_video"`
+	LastFrame   bool `json:"last_frame"`
+	Audio       bool `json:"audio"`
+	VideoInput  bool `json:"video_input"`
+	Mask        bool `json:"mask"` // accepts maskImage to keep the product untouched
+	FPS         int  `json:"fps,omitempty"`
+	MinDuration int  `json:"min_duration,omitempty"`
+	MaxDuration int  `json:"max_duration,omitempty"`
+	// Smallest frame per ratio the model renders, used for previews;
+	// ratios it doesn't list preview at the regular size
+	MinSizes map[string][2]int `json:"min_sizes,omitempty"`
+}
+
+// ModelConfig maps a friendly alias to a Runware model ID.
+//
+// Pricing: DurationPrices gives exact prices for specific durations, then
+// PricePerSecond scales with duration, and Price is a flat per-video
+// fallback for providers that don't charge by length.
+type ModelConfig struct {
+	Alias          string          `json:"alias"`
+	ID             string          `json:"id"`
+	Name           string          `json:"name"`
+	Provider       string          `json:"provider"`
+	Price          float64         `json:"price,omitempty"`
+	PricePerSecond float64         `json:"price_per_second,omitempty"`
+	DurationPrices map[int]float64 `json:"duration_prices,omitempty"`
+	Caps           ModelCaps       `json:"caps"`
+	// Expected render time until the model has history; see estimateSeconds
+	TypicalSeconds int `json:"typical_seconds,omitempty"`
+	// Seconds to wait before the first poll; defaults to the poll interval
+	InitialPollDelay int `json:"initial_poll_delay,omitempty"`
+	// What the model tends to get wrong; defaults to its provider's entry
+	// in provider_negative_prompts
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+}
+
+// costFor returns the price of one video of the given length in seconds.
+func (m *ModelConfig) costFor(duration int) float64 {
+	if p, ok := m.DurationPrices[duration]; ok {
+		return p
+	}
+	if m.PricePerSecond > 0 {
+		return math.Round(m.PricePerSecond*float64(duration)*100) / 100
+	}
+	return m.Price
+}
+
+// StyleConfig is an ad style: a base prompt rendered by one model alias.
+type StyleConfig struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	// Models the request may pick instead of Model; empty allows any
+	Models []string `json:"models,omitempty"`
+	// Model retried once when the primary is unavailable at the provider
+	FallbackModel string `json:"fallback_model,omitempty"`
+	// Ratio used when a request names the style but no ratio
+	RecommendedRatio string `json:"recommended_ratio,omitempty"`
+	// Added to the model's negative prompt for this style
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	// Bounds on the images a request brings, counting uploads, frame
+	// anchors and inline images; 0 leaves that side open
+	MinImages int `json:"min_images,omitempty"`
+	MaxImages int `json:"max_images,omitempty"`
+}
+
+// checkImages reports whether n input images suit the style.
+func (s *StyleConfig) checkImages(n int) error {
+	if n < s.MinImages {
+		return fmt.Errorf("Style %s needs at least %d image(s), got %d", s.ID, s.MinImages, n)
+	}
+	if s.MaxImages > 0 && n > s.MaxImages {
+		return fmt.Errorf("Style %s takes at most %d image(s), got %d", s.ID, s.MaxImages, n)
+	}
+	return nil
+}
+
+// allows reports whether the style can be rendered by the model alias.
+func (s *StyleConfig) allows(alias string) bool {
+	if len(s.Models) == 0 || alias == s.Model {
+		return true
+	}
+	for _, m := range s.Models {
+		if m == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// PresetConfig bundles generate settings under one name. Zero values leave
+// the field to the request or the usual default.
+type PresetConfig struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Style    string `json:"style,omitempty"`
+	Ratio    string `json:"ratio,omitempty"`
+	Duration int    `json:"duration,omitempty"`
+	Count    int    `json:"count,omitempty"`
+	Audio    *bool  `json:"audio,omitempty"`
+}
+
+type registryFile struct {
+	Models  []ModelConfig  `json:"models"`
+	Styles  []StyleConfig  `json:"styles"`
+	Presets []PresetConfig `json:"presets"`
+	// Negative prompt per provider for models that don't set their own
+	ProviderNegatives map[string]string `json:"provider_negative_prompts,omitempty"`
+}
+
+var defaultRegistry = registryFile{
+	Models: []ModelConfig{
+		{Alias: "veo-3.1-fast", ID: "google:3@3", Name: "Veo 3.1 Fast", Provider: "google", PricePerSecond: 0.10, TypicalSeconds: 120, InitialPollDelay: 30,
+			Caps: ModelCaps{TextToVideo: true, LastFrame: true, Audio: true, FPS: 24, MinDuration: 4, MaxDuration: 8}},
+		{Alias: "pixverse-5.6", ID: "pixverse:1@7", Name: "PixVerse v5.6", Provider: "pixverse", PricePerSecond: 0.048, TypicalSeconds: 60, InitialPollDelay: 15,
+			Caps: ModelCaps{TextToVideo: true, LastFrame: true, VideoInput: true, MinDuration: 5, MaxDuration: 10,
+				MinSizes: map[string][2]int{"9:16": {360, 640}, "16:9": {640, 360}, "1:1": {360, 360}}}},
+		{Alias: "vidu-q3-turbo", ID: "vidu:4@2", Name: "Vidu Q3 Turbo", Provider: "vidu", PricePerSecond: 0.0325, TypicalSeconds: 30, InitialPollDelay: 3,
+			Caps: ModelCaps{TextToVideo: true, LastFrame: true, Audio: true, MinDuration: 1, MaxDuration: 16, MinSizes: viduMinSizes}},
+		{Alias: "vidu-q3", ID: "vidu:4@1", Name: "Vidu Q3", Provider: "vidu", PricePerSecond: 0.0125, TypicalSeconds: 45, InitialPollDelay: 8,
+			Caps: ModelCaps{TextToVideo: true, LastFrame: true, Audio: true, MinDuration: 1, MaxDuration: 16, MinSizes: viduMinSizes}},
+	},
+	Styles: []StyleConfig{
+		{ID: "cinematic", Name: "Cinematic", Model: "veo-3.1-fast", FallbackModel: "vidu-q3-turbo", RecommendedRatio: "16:9",
+			Prompt: "Cinematic commercial shot. Slow dolly in, dramatic rim lighting, shallow depth of field, premium film look."},
+		{ID: "rotating", Name: "360 Rotating", Model: "vidu-q3-turbo", RecommendedRatio: "1:1",
+			Prompt: "Product rotates a full 360 degrees on a turntable. Clean studio lighting, seamless background, steady camera."},
+		{ID: "lifestyle", Name: "Lifestyle", Model: "pixverse-5.6",
+			Prompt: "Product in a natural everyday setting. Handheld camera, warm daylight, relaxed authentic mood."},
+		{ID: "tiktok", Name: "TikTok / Reels", Model: "vidu-q3", RecommendedRatio: "9:16",
+			Prompt: "Fast-paced social media ad. Quick punch-in zoom, bright colorful lighting, energetic mood."},
+		{ID: "unboxing", Name: "POV Unboxing", Model: "vidu-q3-turbo", RecommendedRatio: "9:16",
+			Prompt: "First-person POV unboxing. Hands open the box and reveal the product, soft overhead lighting, exciting mood."},
+		{ID: "minimal", Name: "Minimal Clean", Model: "vidu-q3", RecommendedRatio: "1:1",
+			Prompt: "Minimal product shot on a plain background. Slow push in, soft even lighting, calm elegant mood."},
+	},
+	Presets: []PresetConfig{
+		{ID: "tiktok-vertical", Name: "TikTok vertical 8s, no audio", Style: "tiktok", Ratio: "9:16", Duration: 8, Count: 1, Audio: boolPtr(false)},
+		{ID: "hero-widescreen", Name: "Cinematic hero 16:9", Style: "cinematic", Ratio: "16:9", Duration: 8, Count: 1},
+		{ID: "catalog-square", Name: "Catalog spin 1:1", Style: "rotating", Ratio: "1:1", Duration: 4, Count: 2},
+	},
+	ProviderNegatives: map[string]string{
+		"vidu":     "warped text, distorted logo, garbled lettering, melting product edges",
+		"pixverse": "artifacts, flicker, noise, smeared details, extra objects",
+	},
+}
+
+// viduMinSizes is Vidu's 540p, its lowest resolution.
+var viduMinSizes = map[string][2]int{"9:16": {540, 960}, "16:9": {960, 540}, "1:1": {540, 540}}
+
+func boolPtr(b bool) *bool { return &b }
+
+// registry is an immutable snapshot of the loaded config. Reloads build a
+// new one and swap the pointer under registryMu; nothing mutates a registry
+// once it's published, so readers never need the lock after snapshot().
+type registry struct {
+	models  map[string]*ModelConfig // by alias
+	byID    map[string]*ModelConfig // by Runware ID
+	styles  map[string]*StyleConfig
+	presets map[string]*PresetConfig
+}
+
+var (
+	current    = &registry{}
+	registryMu sync.RWMutex
+)
+
+// loadRegistry reads models, styles and presets from modelsConfigPath,
+// falling back to the built-in defaults when the file doesn't exist. The
+// registry is only swapped in once the whole file validates.
+func loadRegistry() error {
+	reg, err := parseRegistry()
+	if err != nil {
+		return err
+	}
+
+	registryMu.Lock()
+	current = reg
+	registryMu.Unlock()
+	return nil
+}
+
+func parseRegistry() (*registry, error) {
+	file := defaultRegistry
+
+	data, err := os.ReadFile(modelsConfigPath)
+	if err == nil {
+		file = registryFile{}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", modelsConfigPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read %s: %v", modelsConfigPath, err)
+	}
+
+	reg := &registry{
+		models:  make(map[string]*ModelConfig),
+		byID:    make(map[string]*ModelConfig),
+		styles:  make(map[string]*StyleConfig),
+		presets: make(map[string]*PresetConfig),
+	}
+
+	for i := range file.Models {
+		m := file.Models[i]
+		if m.Alias == "" || m.ID == "" || m.Provider == "" {
+			return nil, fmt.Errorf("model %d: alias, id and provider are required", i+1)
+		}
+		if _, dup := reg.models[m.Alias]; dup {
+			return nil, fmt.Errorf("duplicate model alias: %s", m.Alias)
+		}
+		if m.InitialPollDelay < 0 {
+			return nil, fmt.Errorf("model %s: initial_poll_delay must not be negative", m.Alias)
+		}
+		for ratio, size := range m.Caps.MinSizes {
+			if _, ok := ratioSizes[ratio]; !ok {
+				return nil, fmt.Errorf("model %s: unknown ratio %q in min_sizes", m.Alias, ratio)
+			}
+			if size[0] <= 0 || size[1] <= 0 {
+				return nil, fmt.Errorf("model %s: min_sizes for %s must be positive", m.Alias, ratio)
+			}
+		}
+		if m.Name == "" {
+			m.Name = m.Alias
+		}
+		if m.NegativePrompt == "" {
+			m.NegativePrompt = file.ProviderNegatives[m.Provider]
+		}
+		reg.models[m.Alias] = &m
+		reg.byID[m.ID] = &m
+	}
+
+	for i := range file.Styles {
+		s := file.Styles[i]
+		if s.ID == "" {
+			return nil, fmt.Errorf("style %d: id is required", i+1)
+		}
+		if _, ok := reg.models[s.Model]; !ok {
+			return nil, fmt.Errorf("style %s: unknown model alias %q", s.ID, s.Model)
+		}
+		for _, alias := range s.Models {
+			if _, ok := reg.models[alias]; !ok {
+				return nil, fmt.Errorf("style %s: unknown model alias %q in models", s.ID, alias)
+			}
+		}
+		if _, ok := reg.models[s.FallbackModel]; s.FallbackModel != "" && !ok {
+			return nil, fmt.Errorf("style %s: unknown fallback_model %q", s.ID, s.FallbackModel)
+		}
+		if _, ok := ratioSizes[s.RecommendedRatio]; s.RecommendedRatio != "" && !ok {
+			return nil, fmt.Errorf("style %s: unknown recommended_ratio %q", s.ID, s.RecommendedRatio)
+		}
+		if s.MinImages < 0 || s.MaxImages < 0 || (s.MaxImages > 0 && s.MinImages > s.MaxImages) {
+			return nil, fmt.Errorf("style %s: min_images and max_images must be non-negative with min_images <= max_images", s.ID)
+		}
+		reg.styles[s.ID] = &s
+	}
+
+	for i := range file.Presets {
+		p := file.Presets[i]
+		if p.ID == "" {
+			return nil, fmt.Errorf("preset %d: id is required", i+1)
+		}
+		if _, ok := reg.styles[p.Style]; p.Style != "" && !ok {
+			return nil, fmt.Errorf("preset %s: unknown style %q", p.ID, p.Style)
+		}
+		if _, ok := ratioSizes[p.Ratio]; p.Ratio != "" && !ok {
+			return nil, fmt.Errorf("preset %s: unknown ratio %q", p.ID, p.Ratio)
+		}
+		if p.Duration < 0 || p.Duration > maxDuration {
+			return nil, fmt.Errorf("preset %s: duration must be 1-%d", p.ID, maxDuration)
+		}
+		if p.Count < 0 || p.Count > maxCount {
+			return nil, fmt.Errorf("preset %s: count must be 1-%d", p.ID, maxCount)
+		}
+		reg.presets[p.ID] = &p
+	}
+
+	return reg, nil
+}
+
+// reloadRegistry re-reads the config file and reports which models, styles
+// and presets were added, removed or changed. Jobs already running keep the
+// *ModelConfig they started with.
+func reloadRegistry() (map[string][]string, error) {
+	reg, err := parseRegistry()
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	changes := map[string][]string{}
+	diffConfigs(changes, "models", current.models, reg.models)
+	diffConfigs(changes, "styles", current.styles, reg.styles)
+	diffConfigs(changes, "presets", current.presets, reg.presets)
+
+	current = reg
+	return changes, nil
+}
+
+// diffConfigs records keys added, removed or changed between two maps under
+// "<kind>_added", "<kind>_removed" and "<kind>_changed".
+func diffConfigs[T any](changes map[string][]string, kind string, old, next map[string]*T) {
+	for key, v := range next {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			changes[kind+"_added"] = append(changes[kind+"_added"], key)
+		case !reflect.DeepEqual(*prev, *v):
+			changes[kind+"_changed"] = append(changes[kind+"_changed"], key)
+		}
+	}
+	for key := range old {
+		if _, ok := next[key]; !ok {
+			changes[kind+"_removed"] = append(changes[kind+"_removed"], key)
+		}
+	}
+	for _, suffix := range []string{"_added", "_removed", "_changed"} {
+		sort.Strings(changes[kind+suffix])
+	}
+}
+
+// sortedModels returns all models ordered by alias.
+func (r *registry) sortedModels() []*ModelConfig {
+	list := make([]*ModelConfig, 0, len(r.models))
+	for _, m := range r.models {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Alias < list[j].Alias })
+	return list
+}
+
+// sortedStyles returns all styles ordered by ID.
+func (r *registry) sortedStyles() []*StyleConfig {
+	list := make([]*StyleConfig, 0, len(r.styles))
+	for _, s := range r.styles {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// sortedPresets returns all presets ordered by ID.
+func (r *registry) sortedPresets() []*PresetConfig {
+	list := make([]*PresetConfig, 0, len(r.presets))
+	for _, p := range r.presets {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// snapshot returns the registry in effect now. A request that resolves
+// several related entries (a style and its model, a preset and its style)
+// should use one snapshot so a concurrent reload can't split them.
+func snapshot() *registry {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return current
+}
+
+// model resolves either an alias or a raw Runware model ID.
+func (r *registry) model(ref string) (*ModelConfig, bool) {
+	if m, ok := r.models[ref]; ok {
+		return m, true
+	}
+	m, ok := r.byID[ref]
+	return m, ok
+}
+
+// style returns the style with the given ID.
+func (r *registry) style(id string) (*StyleConfig, bool) {
+	s, ok := r.styles[id]
+	return s, ok
+}
+
+// preset returns the preset with the given ID.
+func (r *registry) preset(id string) (*PresetConfig, bool) {
+	p, ok := r.presets[id]
+	return p, ok
+}
+
+// lookupModel resolves a model against the current registry.
+func lookupModel(ref string) (*ModelConfig, bool) { return snapshot().model(ref) }
+
+// firstPollDelay is how long after submission a job on this model is
+// first polled. Fast models are checked sooner than the usual interval and
+// slow ones don't spend polls before they could possibly be done.
+func (m *ModelConfig) firstPollDelay() time.Duration {
+	if m == nil || m.InitialPollDelay == 0 {
+		return pollInterval
+	}
+	return time.Duration(m.InitialPollDelay) * time.Second
+}
+
+// shortestDuration is the cheapest clip length the model accepts.
+func (m *ModelConfig) shortestDuration() int {
+	if m.Caps.MinDuration > 0 {
+		return m.Caps.MinDuration
+	}
+	return 1
+}
+
+// longestDuration is the longest clip the model accepts.
+func (m *ModelConfig) longestDuration() int {
+	if m.Caps.MaxDuration > 0 && m.Caps.MaxDuration < maxDuration {
+		return m.Caps.MaxDuration
+	}
+	return maxDuration
+}
+
+// Units a generate request's duration can be given in.
+const (
+	durationSeconds = "seconds"
+	durationFrames  = "frames"
+)
+
+// resolveDuration turns a requested duration into the whole seconds sent
+// to the provider. Frames are divided by the model's fps and rounded to the
+// nearest second. The result must be within what the model supports.
+func (m *ModelConfig) resolveDuration(value int, unit string) (int, error) {
+	seconds := value
+	if unit == durationFrames {
+		if m.Caps.FPS <= 0 {
+			return 0, fmt.Errorf("Model %s has no fps configured; give duration in seconds", m.Alias)
+		}
+		seconds = int(math.Round(float64(value) / float64(m.Caps.FPS)))
+	}
+	lo, hi := m.shortestDuration(), m.longestDuration()
+	if seconds >= lo && seconds <= hi {
+		return seconds, nil
+	}
+	if unit == durationFrames {
+		return 0, fmt.Errorf("%d frames at %d fps is %d seconds; model %s supports %d-%d seconds (%d-%d frames)",
+			value, m.Caps.FPS, seconds, m.Alias, lo, hi, lo*m.Caps.FPS, hi*m.Caps.FPS)
+	}
+	return 0, fmt.Errorf("duration must be %d-%d seconds for model %s", lo, hi, m.Alias)
+}
+
+// providerSettings returns the provider-specific payload fields for a model.
+// Audio is only requested when the model supports it.
+func providerSettings(m *ModelConfig, audio bool) map[string]interface{} {
+	audio = audio && m.Caps.Audio
+	switch m.Provider {
+	case "google":
+		return map[string]interface{}{
+			"google": map[string]interface{}{
+				"generateAudio": audio,
+				"enhancePrompt": true,
+			},
+		}
+	case "vidu":
+		return map[string]interface{}{
+			"vidu": map[string]interface{}{
+				"audio": audio,
+			},
+		}
+	case "pixverse":
+		return map[string]interface{}{
+			"pixverse": map[string]interface{}{
+				"thinking": "auto",
+			},
+		}
+	}
+	return nil
+}
+
+// negativePrompt combines the model's negative prompt with the style's and
+// the request's, skipping the ones that are empty.
+func negativePrompt(m *ModelConfig, style *StyleConfig, requested string) string {
+	parts := []string{m.NegativePrompt}
+	if style != nil {
+		parts = append(parts, style.NegativePrompt)
+	}
+	parts = append(parts, requested)
+
+	var out []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ", ")
+}
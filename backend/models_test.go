@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeRegistry writes the default config to path with the cinematic
+// style's prompt replaced, so each reload has something to swap in.
+func writeRegistry(t *testing.T, path, prompt string) {
+	t.Helper()
+	file := defaultRegistry
+	file.Styles = append([]StyleConfig(nil), defaultRegistry.Styles...)
+	for i := range file.Styles {
+		if file.Styles[i].ID == "cinematic" {
+			file.Styles[i].Prompt = prompt
+		}
+	}
+	data, err := json.Marshal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReloadDuringGenerate reloads the registry while generations resolve
+// styles and models against it. Run with -race.
+func TestReloadDuringGenerate(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir) // jobs.json and uploads land here
+
+	oldPath, oldMock := modelsConfigPath, allowMockOverride
+	modelsConfigPath, allowMockOverride = filepath.Join(dir, "models.json"), true
+	t.Cleanup(func() {
+		modelsConfigPath, allowMockOverride = oldPath, oldMock
+		loadRegistry()
+	})
+	writeRegistry(t, modelsConfigPath, "first prompt")
+	if err := loadRegistry(); err != nil {
+		t.Fatal(err)
+	}
+
+	const rounds = 50
+	var wg sync.WaitGroup
+	errs := make(chan string, 3*rounds)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		prompts := []string{"first prompt", "second prompt"}
+		for i := 0; i < rounds; i++ {
+			writeRegistry(t, modelsConfigPath, prompts[i%2])
+			rec := httptest.NewRecorder()
+			handleAdminReload(rec, httptest.NewRequest("POST", "/api/admin/reload", nil))
+			if rec.Code != http.StatusOK {
+				errs <- "reload: " + rec.Body.String()
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			reg := snapshot()
+			style, ok := reg.styles["cinematic"]
+			if !ok {
+				errs <- "snapshot: cinematic style missing"
+				continue
+			}
+			if _, ok := reg.model(style.Model); !ok {
+				errs <- "snapshot: style model " + style.Model + " missing"
+			}
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		body := `{"style":"cinematic","text_to_video":true,"prompt":"a mug on a table","duration":4}`
+		for i := 0; i < rounds; i++ {
+			rec := httptest.NewRecorder()
+			handleGenerate(rec, httptest.NewRequest("POST", "/api/generate?mock=true", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				errs <- "generate: " + rec.Body.String()
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// renderTarget is one style and the models a generate request renders it
+// with. A request without styles has a single target.
+type renderTarget struct {
+	style    *StyleConfig // nil for a plain prompt
+	model    *ModelConfig
+	fallback *ModelConfig
+	duration int
+	fullDur  int // duration a preview is promoted at
+	ratio    string
+}
+
+// resolveTargets looks up each style and the model it renders on. An
+// explicit model overrides every style's default and must be allowed by
+// each of them. An empty style ID means no style.
+func resolveTargets(reg *registry, styleIDs []string, modelRef string) ([]renderTarget, error) {
+	var targets []renderTarget
+	for _, id := range styleIDs {
+		var style *StyleConfig
+		ref := modelRef
+		if id != "" {
+			s, ok := reg.style(id)
+			if !ok {
+				return nil, fmt.Errorf("Unknown style: %s", id)
+			}
+			style = s
+			if ref == "" {
+				ref = s.Model
+			}
+		}
+
+		model, ok := reg.model(ref)
+		if !ok {
+			return nil, fmt.Errorf("Unknown model: %s", ref)
+		}
+		if style != nil && !style.allows(model.Alias) {
+			return nil, fmt.Errorf("Style %s cannot be used with model %s", style.ID, model.Alias)
+		}
+		var fallback *ModelConfig
+		if style != nil && style.FallbackModel != "" && style.FallbackModel != model.Alias {
+			fallback, _ = reg.model(style.FallbackModel)
+		}
+		targets = append(targets, renderTarget{style: style, model: model, fallback: fallback})
+	}
+	return targets, nil
+}
+
+// cleanStyles checks a styles[] list: non-empty, no blanks, at most
+// maxStyleVariations. Repeats are dropped; count covers re-rolls.
+func cleanStyles(ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("styles must not be empty when provided")
+	}
+	var out []string
+	for i, id := range ids {
+		if id == "" {
+			return nil, fmt.Errorf("styles[%d] is empty", i)
+		}
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	if len(out) > maxStyleVariations {
+		return nil, fmt.Errorf("At most %d styles per request", maxStyleVariations)
+	}
+	return out, nil
+}
+
+// lacking returns the first target whose model is missing a capability the
+// request needs.
+func lacking(targets []renderTarget, has func(ModelCaps) bool) (*ModelConfig, bool) {
+	for _, t := range targets {
+		if !has(t.model.Caps) {
+			return t.model, true
+		}
+	}
+	return nil, false
+}
+
+// recommendedRatio is the ratio the target renders at when the request
+// doesn't name one.
+func (t renderTarget) recommendedRatio() string {
+	if t.style != nil && t.style.RecommendedRatio != "" {
+		return t.style.RecommendedRatio
+	}
+	return defaultRatio
+}
+
+// styleID is the style a target's jobs record.
+func (t renderTarget) styleID() string {
+	if t.style == nil {
+		return ""
+	}
+	return t.style.ID
+}
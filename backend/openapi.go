@@ -0,0 +1,18 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes every route registered in main. It is kept by hand
+// next to the handlers, so a change to a request or response body should
+// update openapi.json in the same commit.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Poll cadence shared by the batched and per-job pollers.
+const (
+	pollInterval = 5 * time.Second
+	maxPolls     = 120
+)
+
+type pollTask struct {
+	job      *Job
+	taskUUID string
+	polls    int
+	next     time.Time // when the task is next due for a poll
+	handled  bool      // false when handed back for per-job polling
+	done     chan struct{}
+}
+
+// batchPoller collects every in-flight taskUUID and polls them together in
+// one getResponse request per interval, instead of one request per job.
+type batchPoller struct {
+	mu       sync.Mutex
+	tasks    map[string]*pollTask
+	running  bool
+	disabled bool          // provider rejected batched getResponse
+	wake     chan struct{} // a new task may be due before the loop's next poll
+}
+
+var sharedPoller = &batchPoller{tasks: make(map[string]*pollTask), wake: make(chan struct{}, 1)}
+
+// waitForResult blocks until the job's task finishes, using the shared
+// batch poller unless batching is disabled or the provider rejected it.
+func waitForResult(job *Job, taskUUID string) {
+	defer attach(job)()
+	if pollBatching && sharedPoller.wait(job, taskUUID) {
+		return
+	}
+	pollResult(job, taskUUID)
+}
+
+// wait registers the task and blocks until it's resolved. It returns false
+// if the task was handed back for per-job polling.
+func (p *batchPoller) wait(job *Job, taskUUID string) bool {
+	t := &pollTask{
+		job:      job,
+		taskUUID: taskUUID,
+		next:     time.Now().Add(job.model.firstPollDelay()),
+		handled:  true,
+		done:     make(chan struct{}),
+	}
+
+	p.mu.Lock()
+	if p.disabled {
+		p.mu.Unlock()
+		return false
+	}
+	p.tasks[taskUUID] = t
+	if !p.running {
+		p.running = true
+		go p.loop()
+	}
+	p.mu.Unlock()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+
+	<-t.done
+	return t.handled
+}
+
+// loop polls every due task in one request, then sleeps until the next
+// task is due or a new one arrives.
+func (p *batchPoller) loop() {
+	client := &http.Client{Timeout: 30 * time.Second}
+	for {
+		p.mu.Lock()
+		if len(p.tasks) == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		next := now.Add(pollInterval)
+		batch := make([]*pollTask, 0, len(p.tasks))
+		for _, t := range p.tasks {
+			if t.job.cancelled() {
+				delete(p.tasks, t.taskUUID)
+				close(t.done)
+				continue
+			}
+			// Paused tasks keep their place but aren't polled or counted;
+			// resuming wakes the loop
+			if pollPaused(t.job) {
+				continue
+			}
+			if t.next.After(now) {
+				if t.next.Before(next) {
+					next = t.next
+				}
+				continue
+			}
+			batch = append(batch, t)
+		}
+		p.mu.Unlock()
+
+		if len(batch) == 0 {
+			select {
+			case <-time.After(time.Until(next)):
+			case <-p.wake:
+			}
+			continue
+		}
+
+		// Tasks live at the endpoint of the region they were submitted to
+		byEndpoint := make(map[string][]*pollTask)
+		for _, t := range batch {
+			byEndpoint[t.job.endpoint()] = append(byEndpoint[t.job.endpoint()], t)
+		}
+		for endpoint, tasks := range byEndpoint {
+			p.pollBatch(client, endpoint, tasks)
+		}
+	}
+}
+
+func (p *batchPoller) pollBatch(client *http.Client, endpoint string, batch []*pollTask) {
+	payload := make([]map[string]interface{}, 0, len(batch))
+	for _, t := range batch {
+		payload = append(payload, map[string]interface{}{
+			"taskType": "getResponse",
+			"taskUUID": t.taskUUID,
+		})
+	}
+
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+runwareAPIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Printf("Poller: Batch of %d failed: %v\n", len(batch), err)
+		p.tick(batch)
+		return
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	fmt.Printf("Poller: Batch of %d [%d]\n", len(batch), resp.StatusCode)
+
+	// The API doesn't accept multiple getResponse tasks — go back to
+	// per-job polling for everything in flight.
+	if resp.StatusCode == http.StatusBadRequest && len(batch) > 1 {
+		fmt.Printf("Poller: Batching rejected (%s), falling back to per-job polling\n", string(respBody))
+		p.mu.Lock()
+		p.disabled = true
+		for _, t := range p.tasks {
+			t.handled = false
+			delete(p.tasks, t.taskUUID)
+			close(t.done)
+		}
+		p.mu.Unlock()
+		return
+	}
+
+	var pollResp struct {
+		Data   []map[string]interface{} `json:"data"`
+		Errors []map[string]interface{} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &pollResp); err != nil {
+		p.tick(batch)
+		return
+	}
+
+	// Route each item back to its job by taskUUID
+	data := make(map[string][]map[string]interface{})
+	errs := make(map[string][]map[string]interface{})
+	for _, d := range pollResp.Data {
+		id, _ := d["taskUUID"].(string)
+		data[id] = append(data[id], d)
+	}
+	for _, e := range pollResp.Errors {
+		id, _ := e["taskUUID"].(string)
+		errs[id] = append(errs[id], e)
+	}
+
+	var pending []*pollTask
+	for _, t := range batch {
+		own, _ := json.Marshal(map[string]interface{}{"data": data[t.taskUUID], "errors": errs[t.taskUUID]})
+		recordDebugResponse(t.job, "poll", resp.StatusCode, own)
+
+		if applyPollResponse(t.job, data[t.taskUUID], errs[t.taskUUID], p.completeLater(t)) {
+			p.finish(t)
+			continue
+		}
+		pending = append(pending, t)
+	}
+	p.tick(pending)
+}
+
+// tick counts a poll against each task and times out the ones that have
+// used up their budget.
+func (p *batchPoller) tick(batch []*pollTask) {
+	for _, t := range batch {
+		t.polls++
+		t.next = time.Now().Add(pollInterval)
+		if t.polls >= maxPolls {
+			failJob(t.job, categoryProviderOutage, "Timed out waiting for video")
+			p.finish(t)
+		}
+	}
+}
+
+// completeLater finishes a task's video off the poll loop: downloads,
+// captions and transcodes would otherwise hold up every other job's poll.
+// The task leaves the batch at once, but its waiter, which keeps the job
+// attached, is only released once the job is complete.
+func (p *batchPoller) completeLater(t *pollTask) func(*Job, []string) {
+	return func(job *Job, urls []string) {
+		p.mu.Lock()
+		delete(p.tasks, t.taskUUID)
+		p.mu.Unlock()
+		go func() {
+			defer close(t.done)
+			completeJobWithVideo(job, urls)
+		}()
+	}
+}
+
+func (p *batchPoller) finish(t *pollTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.tasks[t.taskUUID]; ok {
+		delete(p.tasks, t.taskUUID)
+		close(t.done)
+	}
+}
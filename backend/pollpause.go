@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// pausePoll stops getResponse calls for the job until resumePoll. Callers
+// hold jobsMu.
+func pausePoll(job *Job) {
+	if job.PollPaused {
+		return
+	}
+	job.PollPaused = true
+	job.pollResumed = make(chan struct{})
+}
+
+// resumePoll lets the job's poller continue. Callers hold jobsMu.
+func resumePoll(job *Job) {
+	if !job.PollPaused {
+		return
+	}
+	job.PollPaused = false
+	close(job.pollResumed)
+	job.pollResumed = nil
+}
+
+// pollPaused reports whether the job's polling is paused.
+func pollPaused(job *Job) bool {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	return job.PollPaused
+}
+
+// waitPollResumed blocks while the job's polling is paused. It reports
+// false if the job was cancelled meanwhile.
+func waitPollResumed(job *Job) bool {
+	for {
+		jobsMu.RLock()
+		paused, resumed := job.PollPaused, job.pollResumed
+		jobsMu.RUnlock()
+		if !paused {
+			return true
+		}
+		select {
+		case <-resumed:
+		case <-job.ctx.Done():
+			return false
+		}
+	}
+}
+
+// handlePausePoll stops polling a job's provider task without failing it,
+// for when the provider is misbehaving. The task is kept and the polls
+// skipped while paused don't count against the job's timeout.
+func handlePausePoll(w http.ResponseWriter, r *http.Request) {
+	setPollPaused(w, r, true)
+}
+
+// handleResumePoll restarts polling paused by handlePausePoll; the next
+// poll goes out straight away.
+func handleResumePoll(w http.ResponseWriter, r *http.Request) {
+	setPollPaused(w, r, false)
+}
+
+func setPollPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	jobsMu.Lock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.Unlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != "processing" || job.taskUUID == "" {
+		status := job.Status
+		jobsMu.Unlock()
+		jsonError(w, fmt.Sprintf("Job is %s and not polling a provider task", status), http.StatusConflict)
+		return
+	}
+	changed := job.PollPaused != paused
+	if paused {
+		pausePoll(job)
+	} else {
+		resumePoll(job)
+	}
+	jobsMu.Unlock()
+
+	if changed {
+		verb := "Resumed"
+		if paused {
+			verb = "Paused"
+		} else {
+			// The batch loop may be asleep until its next due task
+			select {
+			case sharedPoller.wake <- struct{}{}:
+			default:
+			}
+		}
+		jobLogf(job, levelInfo, "%s polling of task %s%s", verb, job.taskUUID, reqTag(requestID(r.Context())))
+		saveJobs()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          job.ID,
+		"status":      "processing",
+		"poll_paused": paused,
+	})
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// frameSize is the width and height a job renders at: its ratio's size, or
+// for a preview or style trial the smallest one its model lists for the ratio.
+func frameSize(job *Job) [2]int {
+	size, ok := ratioSizes[job.Ratio]
+	if !ok {
+		size = ratioSizes[defaultRatio]
+	}
+	if (job.Preview || job.Trial) && job.model != nil {
+		if s, ok := job.model.Caps.MinSizes[job.Ratio]; ok {
+			size = s
+		}
+	}
+	return size
+}
+
+// handlePromote re-runs a completed preview at its full settings: same
+// prompt, seed, model, images and options, at the regular size and the
+// duration originally requested, with audio. A preview is promoted once.
+func handlePromote(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	jobsMu.Lock()
+	prev, ok := jobs[id]
+	if !ok {
+		jobsMu.Unlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !prev.Preview || prev.model == nil {
+		jobsMu.Unlock()
+		jsonError(w, "Only preview jobs can be promoted", http.StatusBadRequest)
+		return
+	}
+	if prev.InlineImages > 0 {
+		jobsMu.Unlock()
+		jsonError(w, "Previews made from inline images can't be promoted; their images are not kept", http.StatusConflict)
+		return
+	}
+	if prev.Status != "completed" && prev.Status != statusEvicted {
+		status := prev.Status
+		jobsMu.Unlock()
+		jsonError(w, fmt.Sprintf("Preview is %s; promote it once it has completed", status), http.StatusConflict)
+		return
+	}
+	if prev.PromotedTo != "" {
+		promoted := prev.PromotedTo
+		jobsMu.Unlock()
+		jsonError(w, fmt.Sprintf("Preview was already promoted to %s", promoted), http.StatusConflict)
+		return
+	}
+	job := &Job{
+		ID:             uuid.New().String()[:12],
+		Prompt:         prev.Prompt,
+		NegativePrompt: prev.NegativePrompt,
+		Product:        prev.Product,
+		Model:          prev.Model,
+		Style:          prev.Style,
+		Ratio:          prev.Ratio,
+		Duration:       prev.fullDur,
+		Seed:           prev.Seed,
+		Fit:            prev.Fit,
+		SafeZone:       prev.SafeZone,
+		Background:     prev.Background,
+		Cutout:         prev.Cutout,
+		Blur:           prev.Blur,
+		EndOnProduct:   prev.EndOnProduct,
+		Priority:       prev.Priority,
+		Project:        prev.Project,
+		Note:           prev.Note,
+		Tags:           prev.Tags,
+		Experiment:     prev.Experiment,
+		Variant:        prev.Variant,
+		RequestID:      requestID(r.Context()),
+		AppVersion:     appVersion(r.Context()),
+		Mode:           prev.Mode,
+		Mock:           prev.Mock,
+		Captions:       prev.Captions,
+		OutputFormat:   prev.OutputFormat,
+		Region:         prev.Region,
+		Creative:       prev.Creative,
+		PreviewOf:      prev.ID,
+		imagePaths:     prev.imagePaths,
+		videoPath:      prev.videoPath,
+		thumbPath:      prev.thumbPath,
+		firstFrame:     prev.firstFrame,
+		lastFrame:      prev.lastFrame,
+		maskPath:       prev.maskPath,
+		narration:      prev.narration,
+		model:          prev.model,
+		fallback:       prev.fallback,
+		audio:          prev.audio,
+	}
+	// Only an uploaded thumbnail carries over; the preview's own frame
+	// doesn't belong to the full render
+	if prev.thumbPath != "" {
+		job.ThumbnailURL = prev.ThumbnailURL
+	}
+	job.RequestedDuration, job.DurationUnit = prev.RequestedDuration, prev.DurationUnit
+	prev.PromotedTo = job.ID
+	jobsMu.Unlock()
+
+	if job.Duration == 0 {
+		job.Duration = defaultDuration
+	}
+
+	submitJob(job)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":     job.ID,
+		"status":     "queued",
+		"preview_of": id,
+		"duration":   job.Duration,
+		"price":      job.model.costFor(job.Duration),
+		"message":    "Full render queued",
+	})
+}
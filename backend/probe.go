@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ratioTolerance is how far the output's aspect ratio may drift from the
+// requested one before it counts as a mismatch. Providers round sizes to
+// multiples of 8 or 16, which alone moves the ratio by a percent or so.
+const ratioTolerance = 0.03
+
+// probeVideoSize returns the width and height of the first video stream in
+// path using ffprobe.
+func probeVideoSize(ctx context.Context, path string) (int, int, error) {
+	out, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=s=x:p=0",
+		path,
+	).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var w, h int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%dx%d", &w, &h); err != nil {
+		return 0, 0, fmt.Errorf("unexpected ffprobe output %q", out)
+	}
+	if w <= 0 || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid video size %dx%d", w, h)
+	}
+	return w, h, nil
+}
+
+// ratioMismatch reports whether a w×h video is noticeably off the aspect
+// ratio that was requested.
+func ratioMismatch(ratio string, w, h int) bool {
+	size, ok := ratioSizes[ratio]
+	if !ok {
+		return false
+	}
+	want := float64(size[0]) / float64(size[1])
+	got := float64(w) / float64(h)
+	diff := got/want - 1
+	return diff > ratioTolerance || diff < -ratioTolerance
+}
+
+// probeVideoDuration returns the length of the video at path in seconds
+// using ffprobe.
+func probeVideoDuration(ctx context.Context, path string) (float64, error) {
+	out, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	).Output()
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("unexpected ffprobe output %q", out)
+	}
+	return d, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Project IDs double as directory names under uploads/.
+var projectPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// uploadDir returns the directory uploads for project are saved in,
+// creating it on first use. An empty project is the shared uploads/ root.
+func uploadDir(project string) (string, error) {
+	if project == "" {
+		return "uploads", nil
+	}
+	if !projectPattern.MatchString(project) {
+		return "", fmt.Errorf("invalid project_id %q: use lowercase letters, digits, - and _", project)
+	}
+	dir := filepath.Join("uploads", project)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// uploadName is the filename clients use for an upload: the bare name, or
+// "project/name" when it belongs to a project.
+func uploadName(project, name string) string {
+	return path.Join(project, name)
+}
+
+// handleListProjects lists every project with its upload and job counts.
+func handleListProjects(w http.ResponseWriter, r *http.Request) {
+	type projectInfo struct {
+		ID      string `json:"id"`
+		Uploads int    `json:"uploads"`
+		Jobs    int    `json:"jobs"`
+	}
+	projects := make(map[string]*projectInfo)
+	get := func(id string) *projectInfo {
+		if projects[id] == nil {
+			projects[id] = &projectInfo{ID: id}
+		}
+		return projects[id]
+	}
+
+	entries, _ := os.ReadDir("uploads")
+	for _, e := range entries {
+		if !e.IsDir() || !projectPattern.MatchString(e.Name()) {
+			continue
+		}
+		files, _ := os.ReadDir(filepath.Join("uploads", e.Name()))
+		get(e.Name()).Uploads = len(files)
+	}
+
+	jobsMu.RLock()
+	for _, j := range jobs {
+		if j.Project != "" {
+			get(j.Project).Jobs++
+		}
+	}
+	jobsMu.RUnlock()
+
+	list := make([]*projectInfo, 0, len(projects))
+	for _, p := range projects {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"projects": list})
+}
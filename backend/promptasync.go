@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// promptTaskTTL is how long a finished async auto-prompt stays fetchable.
+const promptTaskTTL = time.Hour
+
+// promptTask is an auto-prompt running in the background for
+// /api/auto-prompt?async=true. Tasks are kept in memory only.
+type promptTask struct {
+	token    string
+	status   string // processing, completed or failed
+	result   map[string]interface{}
+	err      string
+	created  string
+	finished time.Time
+	reqID    string
+	callback string
+	auth     string
+}
+
+var (
+	promptTasksMu sync.Mutex
+	promptTasks   = make(map[string]*promptTask)
+)
+
+// startPromptTask answers 202 with a token and writes the prompt in the
+// background, POSTing the outcome to callbackURL when one is given.
+func startPromptTask(w http.ResponseWriter, r *http.Request, spec autoPromptSpec, callbackURL, callbackAuth string) {
+	task := &promptTask{
+		token:    uuid.New().String(),
+		status:   "processing",
+		created:  timestamp(),
+		reqID:    requestID(r.Context()),
+		callback: callbackURL,
+		auth:     callbackAuth,
+	}
+	promptTasksMu.Lock()
+	for token, t := range promptTasks {
+		if !t.finished.IsZero() && time.Since(t.finished) > promptTaskTTL {
+			delete(promptTasks, token)
+		}
+	}
+	promptTasks[task.token] = task
+	promptTasksMu.Unlock()
+
+	// The request's context ends with this response; keep its IDs for logs
+	ctx := context.WithoutCancel(r.Context())
+	go runPromptTask(ctx, task, spec)
+
+	fmt.Printf("AutoPrompt%s: Started async task %s\n", reqTag(task.reqID), task.token)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      task.token,
+		"status":     task.status,
+		"status_url": fmt.Sprintf("http://localhost:8080/api/auto-prompt/%s", task.token),
+	})
+}
+
+func runPromptTask(ctx context.Context, task *promptTask, spec autoPromptSpec) {
+	result, _, err := autoPrompt(ctx, spec)
+
+	promptTasksMu.Lock()
+	event := eventCompleted
+	if err != nil {
+		task.status, task.err = "failed", err.Error()
+		event = eventFailed
+	} else {
+		task.status, task.result = "completed", result
+	}
+	task.finished = time.Now()
+	fields := task.fields()
+	promptTasksMu.Unlock()
+
+	tag := reqTag(task.reqID)
+	fmt.Printf("AutoPrompt%s: Async task %s %s\n", tag, task.token, task.status)
+	if task.callback == "" {
+		return
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event":       event,
+		"at":          timestamp(),
+		"auto_prompt": fields,
+	})
+	deliverCallback(task.callback, task.auth, task.reqID, event, payload, func(level, format string, args ...interface{}) {
+		fmt.Printf("AutoPrompt%s: Task %s: %s\n", tag, task.token, fmt.Sprintf(format, args...))
+	})
+}
+
+// fields is the task as /api/auto-prompt/{token} and its callback show it:
+// the usual auto-prompt response once completed, error once failed.
+// Callers hold promptTasksMu.
+func (t *promptTask) fields() map[string]interface{} {
+	fields := map[string]interface{}{}
+	for k, v := range t.result {
+		fields[k] = v
+	}
+	fields["token"] = t.token
+	fields["status"] = t.status
+	fields["created_at"] = t.created
+	if t.err != "" {
+		fields["error"] = t.err
+	}
+	return fields
+}
+
+// handlePromptTask returns an async auto-prompt's progress or outcome, for
+// clients that poll instead of taking a callback.
+func handlePromptTask(w http.ResponseWriter, r *http.Request) {
+	promptTasksMu.Lock()
+	task, ok := promptTasks[r.PathValue("token")]
+	if ok && !task.finished.IsZero() && time.Since(task.finished) > promptTaskTTL {
+		delete(promptTasks, task.token)
+		ok = false
+	}
+	var fields map[string]interface{}
+	if ok {
+		fields = task.fields()
+	}
+	promptTasksMu.Unlock()
+	if !ok {
+		jsonError(w, "Auto-prompt task not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// A fenced block, with or without a language tag
+	fencePattern = regexp.MustCompile("(?s)```[A-Za-z]*\\s*\\n?(.*?)```")
+	// "Sure!", "Here's your prompt:", "Sure! Here is a video prompt for
+	// scene 2:", matched against a whole line so prompt text is never cut
+	preamblePattern = regexp.MustCompile(`(?i)^(?:(?:sure|okay|ok|certainly|of course)[,!.]?|(?:(?:sure|okay|ok|certainly|of course)[,!.]?\s+)?(?:here(?:'s|’s| is| are)|below is)\b[^:]{0,60}:)$`)
+	// "Prompt:", "**Video prompt:**", "Scene 2 prompt -"
+	labelPattern = regexp.MustCompile(`(?i)^\**\s*((video|scene( \d+)?|ad)\s+)?prompt\s*\**\s*[:\-–]\s*\**\s*`)
+	// Paragraphs that explain the prompt rather than being part of it
+	afterwordPattern = regexp.MustCompile(`(?i)^(\**\s*)?(note|explanation|why this works|this prompt|this (works|focuses|keeps|captures)|i hope|hope this|let me know|feel free)\b`)
+)
+
+// quotePairs are the wrappers a whole reply may come in.
+var quotePairs = [][2]string{{`"`, `"`}, {"“", "”"}, {"'", "'"}, {"**", "**"}, {"*", "*"}, {"`", "`"}}
+
+// cleanPromptReply extracts the prompt from a chatty model reply: the first
+// code fence's contents, without a "Here's your prompt:" preamble, a
+// "Prompt:" label, surrounding quotes or a trailing explanation. Each step
+// only removes text matching a known pattern, and if cleaning would leave
+// nothing the trimmed reply is returned as it was.
+func cleanPromptReply(reply string) string {
+	original := strings.TrimSpace(reply)
+	s := original
+
+	if m := fencePattern.FindStringSubmatch(s); m != nil && strings.TrimSpace(m[1]) != "" {
+		s = m[1]
+	}
+
+	// Drop explanation paragraphs after the prompt
+	paragraphs := strings.Split(strings.TrimSpace(s), "\n\n")
+	for i := 1; i < len(paragraphs); i++ {
+		if afterwordPattern.MatchString(strings.TrimSpace(paragraphs[i])) {
+			paragraphs = paragraphs[:i]
+			break
+		}
+	}
+	s = strings.TrimSpace(strings.Join(paragraphs, "\n\n"))
+
+	// A preamble only counts on a line of its own
+	if first, rest, ok := strings.Cut(s, "\n"); ok && preamblePattern.MatchString(strings.TrimSpace(first)) {
+		s = strings.TrimSpace(rest)
+	}
+	s = strings.TrimSpace(labelPattern.ReplaceAllString(s, ""))
+
+	for _, q := range quotePairs {
+		if len(s) > len(q[0])+len(q[1]) && strings.HasPrefix(s, q[0]) && strings.HasSuffix(s, q[1]) {
+			inner := s[len(q[0]) : len(s)-len(q[1])]
+			// Only a true wrapper: the quote doesn't reappear inside
+			if !strings.Contains(inner, q[0]) && !strings.Contains(inner, q[1]) {
+				s = strings.TrimSpace(inner)
+			}
+		}
+	}
+
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return original
+	}
+	return s
+}
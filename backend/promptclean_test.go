@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestCleanPromptReply(t *testing.T) {
+	tests := []struct {
+		name, reply, want string
+	}{
+		{"plain", "Slow dolly in on the mug, warm light.", "Slow dolly in on the mug, warm light."},
+		{"fence", "```\nSlow dolly in on the mug.\n```", "Slow dolly in on the mug."},
+		{"fence with language", "```text\nSlow dolly in on the mug.\n```", "Slow dolly in on the mug."},
+		{"preamble line", "Here's your prompt:\nSlow dolly in on the mug.", "Slow dolly in on the mug."},
+		{"acknowledged preamble", "Sure! Here is a video prompt for scene 2:\nSlow dolly in on the mug.", "Slow dolly in on the mug."},
+		{"bare acknowledgement", "Certainly.\nSlow dolly in on the mug.", "Slow dolly in on the mug."},
+		{"label", "**Video prompt:** Slow dolly in on the mug.", "Slow dolly in on the mug."},
+		{"quotes", "\"Slow dolly in on the mug.\"", "Slow dolly in on the mug."},
+		{"afterword", "Slow dolly in on the mug.\n\nNote: this keeps the logo readable.", "Slow dolly in on the mug."},
+		{"everything", "Sure!\n```\nPrompt: \"Slow dolly in on the mug.\"\n```\n\nLet me know if you want changes.", "Slow dolly in on the mug."},
+		{"empty after cleaning", "Here's your prompt:", "Here's your prompt:"},
+
+		// Prompt text that only looks like a preamble is kept
+		{"absolutely in prompt", "Absolutely stunning close-up of the mug: camera pushes in", "Absolutely stunning close-up of the mug: camera pushes in"},
+		{"here in prompt", "Here is the mug on a marble counter: steam rises as the camera orbits", "Here is the mug on a marble counter: steam rises as the camera orbits"},
+		{"okay in prompt", "Okay-brand sneakers on a rooftop: fast punch-in zoom", "Okay-brand sneakers on a rooftop: fast punch-in zoom"},
+		{"of course in prompt", "Of course the bottle glistens: condensation, backlight, slow pan", "Of course the bottle glistens: condensation, backlight, slow pan"},
+		{"colon on second line", "Close-up of the mug.\nCamera: slow push in.", "Close-up of the mug. Camera: slow push in."},
+		{"long lead-in", "Here is a very long opening sentence that describes the product in loving detail and keeps going:\nslow pan", "Here is a very long opening sentence that describes the product in loving detail and keeps going: slow pan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanPromptReply(tt.reply); got != tt.want {
+				t.Errorf("cleanPromptReply(%q) = %q, want %q", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+var (
+	autoPromptProgressive bool
+	autoPromptSubsampling string
+	cjpegPath             string
+)
+
+// promptSubsampling maps AUTO_PROMPT_JPEG_SUBSAMPLING to cjpeg's -sample.
+var promptSubsampling = map[string]string{"420": "2x2", "444": "1x1"}
+
+// checkPromptJPEGConfig validates the auto-prompt encoding settings.
+func checkPromptJPEGConfig() error {
+	if _, ok := promptSubsampling[autoPromptSubsampling]; !ok {
+		return fmt.Errorf("AUTO_PROMPT_JPEG_SUBSAMPLING must be 420 or 444")
+	}
+	return nil
+}
+
+// encodePromptJPEG prepares an image for the vision model: flattened onto
+// bg, shrunk so its longer edge fits AUTO_PROMPT_MAX_EDGE, and encoded at
+// AUTO_PROMPT_JPEG_QUALITY.
+//
+// Go's encoder only writes baseline 4:2:0 JPEGs. Progressive output or
+// 4:4:4 chroma goes through cjpeg instead, falling back to Go's encoder
+// when cjpeg is missing or fails.
+func encodePromptJPEG(img image.Image, bg color.Color) ([]byte, error) {
+	img = flatten(img, bg)
+	if autoPromptMaxEdge > 0 {
+		img = shrinkToEdge(img, autoPromptMaxEdge)
+	}
+	if autoPromptProgressive || autoPromptSubsampling != "420" {
+		data, err := cjpegEncode(img)
+		if err == nil {
+			return data, nil
+		}
+		fmt.Printf("AutoPrompt: cjpeg failed, encoding a baseline JPEG: %v\n", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: autoPromptJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cjpegEncode encodes img with cjpeg at AUTO_PROMPT_JPEG_QUALITY, with the
+// configured progressive mode and chroma subsampling. The image goes in as
+// a PPM on stdin.
+func cjpegEncode(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	var ppm bytes.Buffer
+	fmt.Fprintf(&ppm, "P6\n%d %d\n255\n", b.Dx(), b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			ppm.Write([]byte{byte(r >> 8), byte(g >> 8), byte(bl >> 8)})
+		}
+	}
+
+	args := []string{"-quality", strconv.Itoa(autoPromptJPEGQuality), "-sample", promptSubsampling[autoPromptSubsampling], "-optimize"}
+	if autoPromptProgressive {
+		args = append(args, "-progressive")
+	}
+	cmd := exec.Command(cjpegPath, args...)
+	cmd.Stdin = &ppm
+	var out, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// shrinkToEdge scales img down, keeping its aspect ratio, so neither side
+// exceeds edge. Smaller images are returned as they are.
+func shrinkToEdge(img image.Image, edge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= edge && h <= edge {
+		return img
+	}
+	if w >= h {
+		w, h = edge, max(1, h*edge/w)
+	} else {
+		w, h = max(1, w*edge/h), edge
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.BiLinear.Scale(out, out.Bounds(), img, b, xdraw.Src, nil)
+	return out
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Job priorities, lowest first.
+var priorityRanks = map[string]int{"low": 0, "normal": 1, "high": 2}
+
+type queuedJob struct {
+	job      *Job
+	rank     int
+	enqueued time.Time
+}
+
+// jobQueue is a priority queue drained by a pool of workers. Waiting jobs
+// gain one rank per priorityAging so low-priority work can't starve;
+// because ranks change over time, pop scans instead of keeping a heap (the
+// queue is small).
+type jobQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	items []*queuedJob
+
+	// At most limit jobs run at once, none while paused. Both can change
+	// at runtime through /api/admin/config; spawned workers never exit, the
+	// ones above limit just wait.
+	limit   int
+	running int
+	spawned int
+	paused  bool
+}
+
+var queue = newJobQueue()
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *jobQueue) push(job *Job) {
+	q.mu.Lock()
+	q.items = append(q.items, &queuedJob{job: job, rank: priorityRanks[job.Priority], enqueued: time.Now()})
+	q.mu.Unlock()
+	// Not Signal: the woken worker may be one above limit
+	q.cond.Broadcast()
+}
+
+// pop blocks until a job is available and a run slot is free, and returns
+// the job with the highest effective rank, oldest first on ties. The caller
+// must call done when the job finishes.
+func (q *jobQueue) pop() *Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 || q.paused || q.running >= q.limit {
+		q.cond.Wait()
+	}
+	q.running++
+
+	now := time.Now()
+	best := 0
+	for i, it := range q.items {
+		if effectiveRank(it, now) > effectiveRank(q.items[best], now) {
+			best = i
+		}
+	}
+	item := q.items[best]
+	q.items = append(q.items[:best], q.items[best+1:]...)
+	return item.job
+}
+
+// remove drops job from the queue if it is still waiting.
+func (q *jobQueue) remove(job *Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, it := range q.items {
+		if it.job == job {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// done frees the run slot taken by pop.
+func (q *jobQueue) done() {
+	q.mu.Lock()
+	q.running--
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+func effectiveRank(it *queuedJob, now time.Time) int {
+	return it.rank + int(now.Sub(it.enqueued)/priorityAging)
+}
+
+// position returns how many queued jobs would run before job, or -1 if it
+// isn't queued.
+func (q *jobQueue) position(job *Job) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var self *queuedJob
+	for _, it := range q.items {
+		if it.job == job {
+			self = it
+		}
+	}
+	if self == nil {
+		return -1
+	}
+	ahead := 0
+	for _, it := range q.items {
+		if it == self {
+			continue
+		}
+		r, mine := effectiveRank(it, now), effectiveRank(self, now)
+		if r > mine || (r == mine && it.enqueued.Before(self.enqueued)) {
+			ahead++
+		}
+	}
+	return ahead
+}
+
+// startWorkers launches n workers that run queued jobs one at a time.
+func startWorkers(n int) {
+	queue.tune(n, false, priorityAging)
+}
+
+// tune sets how many jobs run at once, whether the queue is paused and how
+// fast waiting jobs age, all under one lock, launching workers as needed.
+// Pausing or lowering the count doesn't stop jobs already running.
+func (q *jobQueue) tune(workers int, paused bool, aging time.Duration) {
+	q.mu.Lock()
+	q.limit, q.paused = workers, paused
+	priorityAging = aging
+	for ; q.spawned < workers; q.spawned++ {
+		go func() {
+			for {
+				runJob(q.pop())
+				q.done()
+			}
+		}()
+	}
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// settings returns what tune last applied, with how many jobs are waiting
+// and running.
+func (q *jobQueue) settings() (workers int, paused bool, aging time.Duration, queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit, q.paused, priorityAging, len(q.items), q.running
+}
+
+func runJob(job *Job) {
+	defer attach(job)()
+	jobsMu.Lock()
+	// Cancelled between being popped and getting here
+	if job.cancelled() {
+		jobsMu.Unlock()
+		return
+	}
+	job.Status = "processing"
+	job.started = time.Now()
+	job.StartedAt = job.started.UTC().Format(time.RFC3339)
+	// A cancel releases job.inline at any moment, so the worker keeps its own
+	inline := job.inline
+	jobsMu.Unlock()
+	saveJobs()
+	emitJobEvent(job, eventStarted, nil)
+	jobLogf(job, levelInfo, "Started (priority %s)", job.Priority)
+
+	if useMock || job.Mock {
+		mockGenerate(job)
+	} else {
+		runwareGenerate(job, inline)
+	}
+}
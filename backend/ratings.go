@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+// handleRateJob records feedback on a completed job: a 1-5 rating, thumbs
+// up or down, or both, with an optional comment. Rating again replaces the
+// earlier feedback.
+func handleRateJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rating  int    `json:"rating"`
+		Thumbs  string `json:"thumbs"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.Rating == 0 && req.Thumbs == "" {
+		jsonError(w, "rating or thumbs is required", http.StatusBadRequest)
+		return
+	}
+	if req.Rating != 0 && (req.Rating < minRating || req.Rating > maxRating) {
+		jsonError(w, fmt.Sprintf("rating must be %d-%d", minRating, maxRating), http.StatusBadRequest)
+		return
+	}
+	if req.Thumbs != "" && req.Thumbs != "up" && req.Thumbs != "down" {
+		jsonError(w, "thumbs must be up or down", http.StatusBadRequest)
+		return
+	}
+	// Same rules as a job note
+	comment, err := cleanNote(req.Comment)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("comment exceeds %d characters", maxNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	jobsMu.Lock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.Unlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	// Eviction only drops the local file; the video was delivered
+	if job.Status != "completed" && job.Status != statusEvicted {
+		status := job.Status
+		jobsMu.Unlock()
+		jsonError(w, fmt.Sprintf("Only completed jobs can be rated; this one is %s", status), http.StatusConflict)
+		return
+	}
+	job.Rating, job.Thumbs, job.RatingComment = req.Rating, req.Thumbs, comment
+	jobsMu.Unlock()
+	saveJobs()
+
+	resp := map[string]interface{}{"id": job.ID}
+	if req.Rating != 0 {
+		resp["rating"] = req.Rating
+	}
+	if req.Thumbs != "" {
+		resp["thumbs"] = req.Thumbs
+	}
+	if comment != "" {
+		resp["comment"] = comment
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ratingStats sums up the feedback on a set of jobs.
+type ratingStats struct {
+	Rated       int     `json:"rated"`   // jobs with any feedback
+	Ratings     int     `json:"ratings"` // jobs with a 1-5 rating
+	AvgRating   float64 `json:"avg_rating"`
+	ThumbsUp    int     `json:"thumbs_up"`
+	ThumbsDown  int     `json:"thumbs_down"`
+	totalRating int
+}
+
+func (s *ratingStats) add(j *Job) {
+	if j.Rating > 0 {
+		s.Ratings++
+		s.totalRating += j.Rating
+	}
+	switch j.Thumbs {
+	case "up":
+		s.ThumbsUp++
+	case "down":
+		s.ThumbsDown++
+	}
+	if j.Rating > 0 || j.Thumbs != "" {
+		s.Rated++
+	}
+}
+
+// finish works out the averages once every job is added.
+func (s *ratingStats) finish() {
+	if s.Ratings > 0 {
+		s.AvgRating = round2(float64(s.totalRating) / float64(s.Ratings))
+	}
+}
+
+// groupStats is the outcome of the jobs run on one model or style.
+type groupStats struct {
+	Name      string `json:"name"`
+	Jobs      int    `json:"jobs"`
+	Completed int    `json:"completed"`
+	Failed    int    `json:"failed"`
+	ratingStats
+}
+
+// handleStats reports job counts and feedback overall and per model and
+// style, so operators can see which produce the best-received videos.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	counts := map[string]int{"queued": 0, "processing": 0, "completed": 0, "failed": 0}
+	var overall ratingStats
+	models := map[string]*groupStats{}
+	styles := map[string]*groupStats{}
+
+	jobsMu.RLock()
+	for _, j := range jobs {
+		counts[j.Status]++
+		overall.add(j)
+		groups := []*groupStats{statsFor(models, j.Model)}
+		if j.Style != "" {
+			groups = append(groups, statsFor(styles, j.Style))
+		}
+		for _, g := range groups {
+			g.Jobs++
+			switch j.Status {
+			case "completed", statusEvicted:
+				g.Completed++
+			case "failed":
+				g.Failed++
+			}
+			g.add(j)
+		}
+	}
+	total := len(jobs)
+	jobsMu.RUnlock()
+
+	overall.finish()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":    map[string]interface{}{"total": total, "by_status": counts},
+		"ratings": overall,
+		"models":  sortedGroups(models),
+		"styles":  sortedGroups(styles),
+	})
+}
+
+func statsFor(groups map[string]*groupStats, name string) *groupStats {
+	g, ok := groups[name]
+	if !ok {
+		g = &groupStats{Name: name}
+		groups[name] = g
+	}
+	return g
+}
+
+// sortedGroups finishes the groups and lists them by name.
+func sortedGroups(groups map[string]*groupStats) []*groupStats {
+	out := make([]*groupStats, 0, len(groups))
+	for _, g := range groups {
+		g.finish()
+		out = append(out, g)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
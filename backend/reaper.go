@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	reapAfter    time.Duration
+	reapInterval time.Duration
+)
+
+// attached counts the goroutines working on each job, a worker or a
+// poller, so the reaper never touches a job something is still driving.
+var (
+	attachedMu sync.Mutex
+	attached   = make(map[string]int)
+)
+
+// attach records that the caller is working on job until the returned
+// func is called.
+func attach(job *Job) func() {
+	attachedMu.Lock()
+	attached[job.ID]++
+	attachedMu.Unlock()
+	return func() {
+		attachedMu.Lock()
+		if attached[job.ID]--; attached[job.ID] <= 0 {
+			delete(attached, job.ID)
+		}
+		attachedMu.Unlock()
+	}
+}
+
+func isAttached(id string) bool {
+	attachedMu.Lock()
+	defer attachedMu.Unlock()
+	return attached[id] > 0
+}
+
+// reapStuck handles jobs left in processing for longer than olderThan with
+// nothing working on them. Jobs with a provider task that's still within
+// resumeMaxAge get a poller again, like after a restart; the rest are
+// failed.
+func reapStuck(olderThan time.Duration) (reattached, failed []string) {
+	reattached, failed = []string{}, []string{}
+	var resume, stuck []*Job
+	jobsMu.RLock()
+	for _, j := range jobs {
+		if j.Status != "processing" || j.started.IsZero() || time.Since(j.started) < olderThan {
+			continue
+		}
+		if isAttached(j.ID) {
+			continue
+		}
+		if resumable(j) {
+			resume = append(resume, j)
+		} else {
+			stuck = append(stuck, j)
+		}
+	}
+	jobsMu.RUnlock()
+
+	for _, j := range resume {
+		jobLogf(j, levelWarn, "Reaper re-attaching poll for task %s", j.taskUUID)
+		// Held until the poller attaches itself, so an overlapping run
+		// can't start a second one
+		detach := attach(j)
+		go func(j *Job) {
+			defer detach()
+			waitForResult(j, j.taskUUID)
+		}(j)
+		reattached = append(reattached, j.ID)
+	}
+	for _, j := range stuck {
+		reason := "Reaped: stuck in processing with no provider task"
+		if j.taskUUID != "" {
+			reason = fmt.Sprintf("Reaped: no result for task %s within %s", j.taskUUID, resumeMaxAge)
+		}
+		failJob(j, "", reason)
+		failed = append(failed, j.ID)
+	}
+	sort.Strings(reattached)
+	sort.Strings(failed)
+	return reattached, failed
+}
+
+// startReaper runs reapStuck every REAP_INTERVAL.
+func startReaper() {
+	go func() {
+		for {
+			time.Sleep(reapInterval)
+			reattached, failed := reapStuck(reapAfter)
+			if len(reattached) > 0 || len(failed) > 0 {
+				fmt.Printf("Reaper: Re-attached %d, failed %d\n", len(reattached), len(failed))
+			}
+		}
+	}()
+}
+
+// handleAdminReap runs the reaper now. older_than overrides REAP_AFTER for
+// this run.
+func handleAdminReap(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OlderThan string `json:"older_than"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			bodyError(w, err)
+			return
+		}
+	}
+	olderThan := reapAfter
+	if req.OlderThan != "" {
+		d, err := time.ParseDuration(req.OlderThan)
+		if err != nil || d < 0 {
+			jsonError(w, "older_than must be a duration, e.g. 15m", http.StatusBadRequest)
+			return
+		}
+		olderThan = d
+	}
+
+	reattached, failed := reapStuck(olderThan)
+	fmt.Printf("Admin%s: Reaped jobs older than %s: re-attached %d, failed %d\n", reqTag(requestID(r.Context())), olderThan, len(reattached), len(failed))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"older_than": olderThan.String(),
+		"reattached": reattached,
+		"failed":     failed,
+	})
+}
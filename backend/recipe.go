@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// recipeVersion is the schema version written by GET /api/jobs/{id}/recipe.
+// Recipes from a newer version are refused rather than half understood.
+const recipeVersion = 1
+
+// Recipe is everything needed to render a job again: the exact prompt sent
+// to the provider, the model and settings, and the input files by their
+// client filenames. It is portable between deployments that share the
+// model alias and have the files uploaded.
+type Recipe struct {
+	Version          int             `json:"version"`
+	Style            string          `json:"style,omitempty"`
+	Model            string          `json:"model"`  // alias, resolved against the registry
+	Prompt           string          `json:"prompt"` // style base and creative direction included
+	NegativePrompt   string          `json:"negative_prompt,omitempty"`
+	ProductName      string          `json:"product_name,omitempty"`
+	Ratio            string          `json:"ratio"`
+	Duration         int             `json:"duration"`
+	Seed             int64           `json:"seed,omitempty"` // 0 picks a new one
+	Audio            bool            `json:"audio"`
+	Mode             string          `json:"mode"`
+	Fit              string          `json:"fit,omitempty"`
+	SafeZone         bool            `json:"safe_zone,omitempty"`
+	BackgroundColor  string          `json:"background_color,omitempty"`
+	RemoveBackground bool            `json:"remove_background,omitempty"`
+	BlurBackground   bool            `json:"blur_background,omitempty"`
+	EndOnProduct     bool            `json:"end_on_product,omitempty"`
+	Captions         string          `json:"captions,omitempty"`
+	Narration        string          `json:"narration,omitempty"`
+	OutputFormat     string          `json:"output_format,omitempty"`
+	Region           string          `json:"region,omitempty"`
+	Creative         *CreativeChoice `json:"creative,omitempty"`
+	Frames           RecipeFrames    `json:"frames"`
+
+	// What the model was sent besides the prompt; informational, since it
+	// is rebuilt from the model and audio on import
+	ProviderSettings map[string]interface{} `json:"provider_settings,omitempty"`
+}
+
+// RecipeFrames assigns input files to their roles, the same way the
+// *_filename fields of /api/generate do.
+type RecipeFrames struct {
+	Filenames  []string `json:"filenames,omitempty"`
+	FirstFrame string   `json:"first_frame_filename,omitempty"`
+	LastFrame  string   `json:"last_frame_filename,omitempty"`
+	Mask       string   `json:"mask_filename,omitempty"`
+	Video      string   `json:"video_filename,omitempty"`
+	Thumbnail  string   `json:"thumbnail_filename,omitempty"`
+}
+
+// jobRecipe builds the recipe for a job. Callers hold jobsMu.
+func jobRecipe(job *Job) Recipe {
+	rec := Recipe{
+		Version:          recipeVersion,
+		Style:            job.Style,
+		Model:            job.model.Alias,
+		Prompt:           job.Prompt,
+		NegativePrompt:   job.NegativePrompt,
+		ProductName:      job.Product,
+		Ratio:            job.Ratio,
+		Duration:         job.Duration,
+		Seed:             job.Seed,
+		Audio:            job.audio,
+		Mode:             job.Mode,
+		Fit:              job.Fit,
+		SafeZone:         job.SafeZone,
+		BackgroundColor:  job.Background,
+		RemoveBackground: job.Cutout,
+		BlurBackground:   job.Blur,
+		EndOnProduct:     job.EndOnProduct,
+		Captions:         job.Captions,
+		Narration:        job.narration,
+		OutputFormat:     job.OutputFormat,
+		Region:           job.Region,
+		Creative:         job.Creative,
+		ProviderSettings: providerSettings(job.model, job.audio),
+	}
+	for _, p := range job.imagePaths {
+		rec.Frames.Filenames = append(rec.Frames.Filenames, clientFilename(p))
+	}
+	for dst, p := range map[*string]string{
+		&rec.Frames.FirstFrame: job.firstFrame,
+		&rec.Frames.LastFrame:  job.lastFrame,
+		&rec.Frames.Mask:       job.maskPath,
+		&rec.Frames.Video:      job.videoPath,
+		&rec.Frames.Thumbnail:  job.thumbPath,
+	} {
+		if p != "" {
+			*dst = clientFilename(p)
+		}
+	}
+	return rec
+}
+
+// handleJobRecipe exports a job as a recipe for /api/generate-from-recipe.
+func handleJobRecipe(w http.ResponseWriter, r *http.Request) {
+	jobsMu.RLock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.RUnlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.model == nil {
+		jobsMu.RUnlock()
+		jsonError(w, fmt.Sprintf("Model %s is no longer configured", job.Model), http.StatusConflict)
+		return
+	}
+	rec := jobRecipe(job)
+	jobsMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+}
+
+// handleGenerateFromRecipe queues a job from a recipe. The prompt is used
+// as-is; style and creative direction are already folded into it. frames,
+// when given, replaces the recipe's input files, e.g. with fresh uploads
+// of another product.
+func handleGenerateFromRecipe(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Recipe    *Recipe       `json:"recipe"`
+		Frames    *RecipeFrames `json:"frames"`
+		Priority  string        `json:"priority"`
+		ProjectID string        `json:"project_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+	if req.Recipe == nil {
+		jsonError(w, "recipe is required", http.StatusBadRequest)
+		return
+	}
+	rec := *req.Recipe
+	if req.Frames != nil {
+		rec.Frames = *req.Frames
+	}
+
+	priority := req.Priority
+	if priority == "" {
+		priority = "normal"
+	}
+	if _, ok := priorityRanks[priority]; !ok {
+		jsonError(w, "priority must be one of: low, normal, high", http.StatusBadRequest)
+		return
+	}
+	if req.ProjectID != "" && !projectPattern.MatchString(req.ProjectID) {
+		jsonError(w, fmt.Sprintf("invalid project_id %q", req.ProjectID), http.StatusBadRequest)
+		return
+	}
+
+	reg := snapshot()
+	if rejectDisabledStyles(w, reg, rec.Style) {
+		return
+	}
+	job, err := recipeJob(reg, rec)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job.Priority = priority
+	job.Project = req.ProjectID
+	job.RequestID = requestID(r.Context())
+	job.AppVersion = appVersion(r.Context())
+	submitJob(job)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":   job.ID,
+		"status":   "queued",
+		"model":    job.model.Alias,
+		"duration": job.Duration,
+		"price":    job.model.costFor(job.Duration),
+		"message":  "Video generation queued from recipe",
+	})
+}
+
+// recipeJob validates a recipe against the registry and the uploads on
+// this server and builds the job it describes, ready for submitJob.
+func recipeJob(reg *registry, rec Recipe) (*Job, error) {
+	if rec.Version < 1 || rec.Version > recipeVersion {
+		return nil, fmt.Errorf("unsupported recipe version %d (this server reads up to %d)", rec.Version, recipeVersion)
+	}
+
+	targets, err := resolveTargets(reg, []string{rec.Style}, rec.Model)
+	if err != nil {
+		return nil, err
+	}
+	t := targets[0]
+	caps := t.model.Caps
+
+	prompt := sanitizePrompt(rec.Prompt)
+	if len(prompt) > maxPromptLength {
+		return nil, fmt.Errorf("prompt exceeds %d characters", maxPromptLength)
+	}
+	negative := sanitizePrompt(rec.NegativePrompt)
+	if len(negative) > maxPromptLength {
+		return nil, fmt.Errorf("negative_prompt exceeds %d characters", maxPromptLength)
+	}
+	narration := sanitizePrompt(rec.Narration)
+	if len(narration) > maxPromptLength {
+		return nil, fmt.Errorf("narration exceeds %d characters", maxPromptLength)
+	}
+	if _, ok := ratioSizes[rec.Ratio]; !ok {
+		return nil, fmt.Errorf("Unknown ratio: %s", rec.Ratio)
+	}
+	if rec.Duration < 1 || rec.Duration > maxDuration {
+		return nil, fmt.Errorf("duration must be 1-%d seconds", maxDuration)
+	}
+	if _, err := t.model.resolveDuration(rec.Duration, durationSeconds); err != nil {
+		return nil, err
+	}
+	if err := checkSeed(rec.Seed); err != nil {
+		return nil, err
+	}
+	fit := rec.Fit
+	if fit == "" {
+		fit = fitNone
+	}
+	if !validFits[fit] {
+		return nil, fmt.Errorf("fit must be one of: pad, crop, none")
+	}
+	if rec.SafeZone && fit != fitPad {
+		return nil, fmt.Errorf("safe_zone only works with fit=pad")
+	}
+	var background string
+	if rec.BackgroundColor != "" {
+		bg, err := backgroundColor(rec.BackgroundColor)
+		if err != nil {
+			return nil, err
+		}
+		background = hexColor(bg)
+	}
+	if !validCaptions[rec.Captions] {
+		return nil, fmt.Errorf("captions must be one of: srt, burn")
+	}
+	if rec.Captions != "" && !storeVideosLocally {
+		return nil, fmt.Errorf("captions need a local copy of the video; they are unavailable with STORE_VIDEOS_LOCALLY=false")
+	}
+	if err := checkOutputFormat(rec.OutputFormat); err != nil {
+		return nil, err
+	}
+	if err := checkRegion(rec.Region); err != nil {
+		return nil, err
+	}
+	if rec.BlurBackground && rec.RemoveBackground {
+		return nil, fmt.Errorf("blur_background cannot be combined with remove_background")
+	}
+	if rec.Creative != nil {
+		if _, err := rec.Creative.direction(); err != nil {
+			return nil, err
+		}
+	}
+
+	job := &Job{
+		Prompt:         prompt,
+		NegativePrompt: negative,
+		Product:        rec.ProductName,
+		Model:          t.model.Name,
+		Style:          t.styleID(),
+		Ratio:          rec.Ratio,
+		Duration:       rec.Duration,
+		Seed:           rec.Seed,
+		Fit:            fit,
+		SafeZone:       rec.SafeZone,
+		Background:     background,
+		Cutout:         rec.RemoveBackground,
+		Blur:           rec.BlurBackground,
+		EndOnProduct:   rec.EndOnProduct,
+		Captions:       rec.Captions,
+		OutputFormat:   rec.OutputFormat,
+		Region:         rec.Region,
+		Creative:       rec.Creative,
+		narration:      narration,
+		model:          t.model,
+		fallback:       t.fallback,
+		fullDur:        rec.Duration,
+		audio:          rec.Audio,
+	}
+
+	frames := rec.Frames
+	for _, fn := range frames.Filenames {
+		p, err := resolveUpload(fn)
+		if err != nil {
+			return nil, fmt.Errorf("Image not found: %s", fn)
+		}
+		if isVideoPath(p) {
+			return nil, fmt.Errorf("%s is a video; filenames takes images", fn)
+		}
+		job.imagePaths = append(job.imagePaths, p)
+	}
+	for _, f := range []struct {
+		name, label string
+		dst         *string
+		supported   bool
+		video       bool // the only slot that takes a video rather than an image
+	}{
+		{frames.FirstFrame, "First frame", &job.firstFrame, true, false},
+		{frames.LastFrame, "Last frame", &job.lastFrame, caps.LastFrame, false},
+		{frames.Mask, "Mask", &job.maskPath, caps.Mask, false},
+		{frames.Video, "Video", &job.videoPath, caps.VideoInput, true},
+		{frames.Thumbnail, "Thumbnail image", &job.thumbPath, true, false},
+	} {
+		if f.name == "" {
+			continue
+		}
+		if !f.supported {
+			return nil, fmt.Errorf("Model %s does not support %s input", t.model.Alias, strings.ToLower(f.label))
+		}
+		p, err := resolveUpload(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("%s not found: %s", f.label, f.name)
+		}
+		switch {
+		case f.video && !isVideoPath(p):
+			return nil, fmt.Errorf("%s is not a video; the video takes an .mp4, .mov or .webm upload", f.name)
+		case !f.video && isVideoPath(p):
+			return nil, fmt.Errorf("%s %s is a video, not an image", f.label, f.name)
+		}
+		*f.dst = p
+	}
+	if job.EndOnProduct {
+		if job.lastFrame != "" {
+			return nil, fmt.Errorf("end_on_product cannot be combined with a last frame")
+		}
+		if len(job.imagePaths) == 0 {
+			return nil, fmt.Errorf("end_on_product needs a product image in filenames")
+		}
+		if !caps.LastFrame {
+			return nil, fmt.Errorf("Model %s does not support a last frame", t.model.Alias)
+		}
+	}
+	if t.style != nil {
+		n := len(job.imagePaths)
+		for _, p := range []string{job.firstFrame, job.lastFrame} {
+			if p != "" {
+				n++
+			}
+		}
+		if err := t.style.checkImages(n); err != nil {
+			return nil, err
+		}
+	}
+	if job.thumbPath != "" {
+		job.ThumbnailURL = fmt.Sprintf("http://localhost:8080/uploads/%s", frames.Thumbnail)
+		if name, ok := strings.CutPrefix(frames.Thumbnail, samplePrefix); ok {
+			job.ThumbnailURL = fmt.Sprintf("http://localhost:8080/samples/%s", name)
+		}
+	}
+
+	// The mode follows the inputs, so swapping frames can't leave it stale
+	hasImages := len(job.imagePaths) > 0 || job.firstFrame != "" || job.lastFrame != ""
+	switch {
+	case job.videoPath != "":
+		job.Mode = "video-to-video"
+	case hasImages:
+		job.Mode = "image-to-video"
+	case rec.Mode == "text-to-video":
+		if !caps.TextToVideo {
+			return nil, fmt.Errorf("Model %s does not support text-to-video", t.model.Alias)
+		}
+		job.Mode = "text-to-video"
+	default:
+		return nil, fmt.Errorf("recipe has no input files; add frames or set mode to text-to-video")
+	}
+	if job.maskPath != "" {
+		source := job.firstFrame
+		if source == "" && len(job.imagePaths) > 0 {
+			source = job.imagePaths[0]
+		}
+		if source == "" {
+			return nil, fmt.Errorf("mask_filename needs a source image to cover")
+		}
+		if err := checkMask(job.maskPath, source); err != nil {
+			return nil, err
+		}
+		if job.fallback != nil && !job.fallback.Caps.Mask {
+			job.fallback = nil
+		}
+	}
+	return job, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// runwareRegions maps the region names a generate request may pick to
+// Runware endpoints, from RUNWARE_REGIONS. Jobs without a region use
+// RUNWARE_API_URL.
+var (
+	runwareRegionSpec string
+	runwareRegions    = map[string]string{}
+)
+
+var regionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// loadRegions parses RUNWARE_REGIONS: comma-separated name=url pairs, e.g.
+// "eu=https://eu.example.com/v1,us=https://us.example.com/v1".
+func loadRegions(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rawURL, ok := strings.Cut(entry, "=")
+		name, rawURL = strings.TrimSpace(name), strings.TrimSpace(rawURL)
+		if !ok {
+			return fmt.Errorf("RUNWARE_REGIONS: %q should look like name=url", entry)
+		}
+		if !regionPattern.MatchString(name) {
+			return fmt.Errorf("RUNWARE_REGIONS: region name %q must be lowercase letters, digits and -", name)
+		}
+		if err := checkEndpoint(rawURL); err != nil {
+			return fmt.Errorf("RUNWARE_REGIONS: %s: %v", name, err)
+		}
+		if _, dup := runwareRegions[name]; dup {
+			return fmt.Errorf("RUNWARE_REGIONS: region %s is listed twice", name)
+		}
+		runwareRegions[name] = rawURL
+	}
+	return nil
+}
+
+func checkEndpoint(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http(s) URL", rawURL)
+	}
+	return nil
+}
+
+// regionNames lists the configured regions, sorted.
+func regionNames() []string {
+	names := make([]string, 0, len(runwareRegions))
+	for name := range runwareRegions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkRegion validates region on a generate request.
+func checkRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if len(runwareRegions) == 0 {
+		return fmt.Errorf("region is not available: no regions are configured (RUNWARE_REGIONS)")
+	}
+	if _, ok := runwareRegions[region]; !ok {
+		return fmt.Errorf("region must be one of: %s", strings.Join(regionNames(), ", "))
+	}
+	return nil
+}
+
+// endpoint is the Runware URL the job's tasks are sent to and polled at.
+// A region dropped from RUNWARE_REGIONS since the job was made falls back
+// to RUNWARE_API_URL; runwareGenerate refuses to submit such a job, so
+// this only affects polling tasks already submitted.
+func (j *Job) endpoint() string {
+	if u, ok := runwareRegions[j.Region]; ok {
+		return u
+	}
+	return runwareAPIURL
+}
+
+// redactedRegions is RUNWARE_REGIONS for /api/admin/config.
+func redactedRegions() map[string]string {
+	out := make(map[string]string, len(runwareRegions))
+	for name, u := range runwareRegions {
+		out[name] = redactURL(u)
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// handleRegeneratePrompt writes a fresh auto-prompt for a job's images,
+// steering away from the prompt it was generated with. With "apply" a job
+// that is still queued picks up the new prompt; otherwise the prompt is only
+// returned, ready for a new /api/generate.
+func handleRegeneratePrompt(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string `json:"model"` // Model Runner model, from MODEL_RUNNER_MODELS
+		Apply bool   `json:"apply"`
+	}
+	// The body is optional
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		bodyError(w, err)
+		return
+	}
+	chatModel, err := chatModelFor(req.Model)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	jobsMu.RLock()
+	job, ok := jobs[id]
+	if !ok {
+		jobsMu.RUnlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	paths := jobImages(job)
+	brief := promptBrief{
+		product:  job.Product,
+		duration: job.Duration,
+		rejected: job.Prompt,
+	}
+	styleID := job.Style
+	bg, _ := backgroundColor(job.Background)
+	jobsMu.RUnlock()
+
+	if len(paths) == 0 {
+		jsonError(w, "Job has no input images to prompt from", http.StatusBadRequest)
+		return
+	}
+	style, _ := snapshot().style(styleID)
+	brief.style = style
+
+	var images, used, warnings []string
+	for _, p := range pickRepresentative(paths, autoPromptMaxImages) {
+		name := clientFilename(p)
+		b64, warning, err := promptImage(r.Context(), name, p, bg)
+		if err != nil {
+			continue
+		}
+		images = append(images, b64)
+		used = append(used, name)
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	if len(images) == 0 {
+		jsonError(w, "The job's images are no longer available", http.StatusGone)
+		return
+	}
+
+	prompt, _, status, err := writeAdPrompt(r.Context(), chatModel, images, brief)
+	if err != nil {
+		jsonError(w, err.Error(), status)
+		return
+	}
+
+	applied := false
+	if req.Apply {
+		jobsMu.Lock()
+		if job.Status == "queued" {
+			// Built as handleGenerate did, creative direction included
+			job.Prompt = buildPrompt(style, prompt, job.Product)
+			if job.Creative != nil {
+				if direction, err := job.Creative.direction(); err == nil {
+					job.Prompt = creativePrompt(style, prompt, job.Product, direction)
+				}
+			}
+			applied = true
+		}
+		current := job.Status
+		jobsMu.Unlock()
+		if !applied {
+			jsonError(w, fmt.Sprintf("Job is %s; only queued jobs can take a new prompt", current), http.StatusConflict)
+			return
+		}
+		saveJobs()
+		jobLogf(job, levelInfo, "Prompt regenerated → %s", prompt)
+	}
+
+	result := map[string]interface{}{
+		"job_id":      job.ID,
+		"prompt":      prompt,
+		"model":       chatModel,
+		"images_used": used,
+		"applied":     applied,
+	}
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// jobImages lists the job's image inputs, frame anchors included, without
+// duplicates. Caller holds jobsMu.
+func jobImages(job *Job) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range append(append([]string{job.firstFrame}, job.imagePaths...), job.lastFrame) {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
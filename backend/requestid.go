@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+type requestIDKey struct{}
+
+type appVersionKey struct{}
+
+// Incoming IDs end up in log lines, so anything beyond a plain token is
+// replaced rather than trusted.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// appVersionPattern accepts release tags and build IDs like "1.4.2",
+// "v2.0.0-rc.1+a1b2c3".
+var appVersionPattern = regexp.MustCompile(`^[A-Za-z0-9._+-]{1,64}$`)
+
+// withRequestID tags every request with the caller's X-Request-ID, or a
+// new one, and echoes it in the response. Jobs created by the request
+// carry it so their log lines can be matched to it, along with the
+// frontend's X-App-Version when it sends a valid one.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		if v := r.Header.Get("X-App-Version"); appVersionPattern.MatchString(v) {
+			ctx = context.WithValue(ctx, appVersionKey{}, v)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestID returns the ID withRequestID attached to ctx, if any.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// appVersion returns the X-App-Version withRequestID attached to ctx, if
+// any.
+func appVersion(ctx context.Context) string {
+	v, _ := ctx.Value(appVersionKey{}).(string)
+	return v
+}
+
+// reqTag formats a request ID for a log prefix.
+func reqTag(id string) string {
+	if id == "" {
+		return ""
+	}
+	return " [req " + id + "]"
+}
+
+// logID is how log lines name the job: its ID plus the request and
+// frontend version that created it.
+func (j *Job) logID() string {
+	id := j.ID + reqTag(j.RequestID)
+	if j.AppVersion != "" {
+		id += " [app " + j.AppVersion + "]"
+	}
+	return id
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// safeInsets are the share of each edge of the output that platform UI
+// (captions, buttons, profile overlays) may cover.
+type safeInsets struct {
+	Top, Right, Bottom, Left float64
+}
+
+// safeZones holds the insets per output ratio. The defaults follow the
+// common TikTok/Reels/Shorts guides; SAFE_ZONES overrides them.
+var safeZones = map[string]safeInsets{
+	"9:16": {Top: 0.14, Right: 0.14, Bottom: 0.20, Left: 0.06},
+	"16:9": {Top: 0.05, Right: 0.05, Bottom: 0.05, Left: 0.05},
+	"1:1":  {Top: 0.05, Right: 0.05, Bottom: 0.05, Left: 0.05},
+}
+
+// loadSafeZones applies SAFE_ZONES, e.g. "9:16=0.14,0.14,0.20,0.06;1:1=0.08",
+// on top of the defaults. Values go top, right, bottom, left like CSS; a
+// single value applies to every edge.
+func loadSafeZones(spec string) error {
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ratio, values, ok := strings.Cut(entry, "=")
+		ratio = strings.TrimSpace(ratio)
+		if !ok {
+			return fmt.Errorf("SAFE_ZONES: %q should look like ratio=top,right,bottom,left", entry)
+		}
+		if _, known := ratioSizes[ratio]; !known {
+			return fmt.Errorf("SAFE_ZONES: unknown ratio %q", ratio)
+		}
+
+		var nums []float64
+		for _, v := range strings.Split(values, ",") {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || n < 0 || n >= 0.45 {
+				return fmt.Errorf("SAFE_ZONES: %s inset %q must be a fraction from 0 to 0.45", ratio, v)
+			}
+			nums = append(nums, n)
+		}
+		switch len(nums) {
+		case 1:
+			safeZones[ratio] = safeInsets{nums[0], nums[0], nums[0], nums[0]}
+		case 4:
+			safeZones[ratio] = safeInsets{nums[0], nums[1], nums[2], nums[3]}
+		default:
+			return fmt.Errorf("SAFE_ZONES: %s needs 1 or 4 insets, got %d", ratio, len(nums))
+		}
+	}
+	return nil
+}
+
+// padToSafeZone letterboxes img like fitToRatio's pad mode, but makes the
+// canvas big enough that the whole source sits inside the safe area and
+// centres it there. As with pad, the source itself is never scaled.
+func padToSafeZone(img image.Image, width, height int, z safeInsets, bg color.Color) image.Image {
+	b := img.Bounds()
+	srcW, srcH := float64(b.Dx()), float64(b.Dy())
+	safeW, safeH := 1-z.Left-z.Right, 1-z.Top-z.Bottom
+
+	// Smallest canvas of the output ratio whose safe area holds the source
+	canvasW := math.Max(srcW/safeW, srcH/safeH*float64(width)/float64(height))
+	canvasH := canvasW * float64(height) / float64(width)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(canvasW)), int(math.Ceil(canvasH))))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	offset := image.Pt(
+		int(z.Left*canvasW+(safeW*canvasW-srcW)/2),
+		int(z.Top*canvasH+(safeH*canvasH-srcH)/2),
+	)
+	draw.Draw(canvas, b.Sub(b.Min).Add(offset), img, b.Min, draw.Over)
+	return canvas
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// samplePrefix marks a filename as one of the bundled demo images rather
+// than an upload, e.g. "sample:mug.jpg".
+const samplePrefix = "sample:"
+
+var sampleExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// sampleFiles lists the image files in SAMPLES_DIR, sorted.
+func sampleFiles() []string {
+	entries, _ := os.ReadDir(samplesDir)
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") && sampleExts[strings.ToLower(filepath.Ext(e.Name()))] {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveSample maps "sample:<name>" to its file. The name has to match a
+// listed sample exactly, so nothing outside SAMPLES_DIR can be reached.
+func resolveSample(fn string) (string, error) {
+	name := strings.TrimPrefix(fn, samplePrefix)
+	for _, s := range sampleFiles() {
+		if s == name {
+			return filepath.Join(samplesDir, s), nil
+		}
+	}
+	return "", fmt.Errorf("unknown sample: %s", name)
+}
+
+// clientFilename turns a stored input path back into the filename clients
+// use for it: "project/name" for uploads, "sample:name" for samples.
+func clientFilename(p string) string {
+	if rest, ok := strings.CutPrefix(p, filepath.Clean(samplesDir)+string(filepath.Separator)); ok {
+		return samplePrefix + rest
+	}
+	return strings.TrimPrefix(filepath.ToSlash(p), "uploads/")
+}
+
+// handleListSamples lists the demo images with the filename to pass to
+// /api/generate, /api/auto-prompt and friends.
+func handleListSamples(w http.ResponseWriter, r *http.Request) {
+	samples := []map[string]string{}
+	for _, name := range sampleFiles() {
+		samples = append(samples, map[string]string{
+			"name":      strings.TrimSuffix(name, filepath.Ext(name)),
+			"filename":  samplePrefix + name,
+			"image_url": fmt.Sprintf("http://localhost:8080/samples/%s", name),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"samples": samples})
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+)
+
+// maxSeed is the largest seed sent to Runware; every provider takes a
+// 32-bit unsigned value.
+const maxSeed = 1<<32 - 1
+
+// newSeed picks the seed for a job that wasn't given one. It is always
+// sent and stored, so a recipe or a promoted preview renders the same way.
+func newSeed() int64 {
+	return rand.Int64N(maxSeed) + 1
+}
+
+// checkSeed validates a requested seed; 0 means pick one.
+func checkSeed(seed int64) error {
+	if seed < 0 || seed > maxSeed {
+		return fmt.Errorf("seed must be 1-%d, or 0 for a random one", int64(maxSeed))
+	}
+	return nil
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits for /api/generate-sequence
+const (
+	minSequenceSegments = 2
+	maxSequenceSegments = 6
+)
+
+// lastFrameOffset is how far before the end of a segment its closing frame
+// is taken; seeking to the exact duration lands past the last frame.
+const lastFrameOffset = 0.1
+
+// sequenceTTL is how long a finished sequence stays fetchable. Its jobs
+// and stitched video outlive it like any other.
+const sequenceTTL = 24 * time.Hour
+
+// sequence is a multi-segment ad being chained in the background by
+// /api/generate-sequence. Each segment is an ordinary job, grouped under
+// the sequence ID. Sequences are kept in memory only.
+type sequence struct {
+	id       string
+	status   string // processing, stitching, completed or failed
+	err      string
+	videoURL string
+	product  string
+	style    string
+	created  string
+	finished time.Time
+	reqID    string
+	segments []*sequenceSegment
+}
+
+// sequenceSegment is one part of a sequence. prompt is the hint's or the
+// vision model's direction before the style's base prompt is added.
+type sequenceSegment struct {
+	hint   string
+	prompt string
+	jobID  string
+	frame  string // closing frame, the next segment's first
+}
+
+// sequencePlan is a validated generate-sequence request: what every
+// segment job shares.
+type sequencePlan struct {
+	target     renderTarget
+	product    string
+	filenames  []string
+	imagePaths []string
+	chatModel  string
+	audio      bool
+	priority   string
+	project    string
+}
+
+var (
+	sequencesMu sync.Mutex
+	sequences   = make(map[string]*sequence)
+)
+
+// handleGenerateSequence chains continuation segments automatically: each
+// one is generated, its last frame extracted and auto-prompted into the
+// next, and the finished segments are stitched into one video. It answers
+// 202 straight away; progress is at /api/sequences/{id}.
+func handleGenerateSequence(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ProductName string   `json:"product_name"`
+		Style       string   `json:"style"`
+		Model       string   `json:"model"`        // video model; defaults to the style's
+		PromptModel string   `json:"prompt_model"` // Model Runner model, from MODEL_RUNNER_MODELS
+		Filenames   []string `json:"filenames"`
+		Segments    []struct {
+			Hint   string `json:"hint"`   // steers the auto-prompt for this segment
+			Prompt string `json:"prompt"` // skips the auto-prompt altogether
+		} `json:"segments"`
+		Duration  int    `json:"duration"` // per segment
+		Ratio     string `json:"ratio"`
+		Audio     *bool  `json:"audio"`
+		Priority  string `json:"priority"`
+		ProjectID string `json:"project_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	if req.Style == "" {
+		jsonError(w, "style is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Filenames) == 0 {
+		jsonError(w, "filenames is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Segments) < minSequenceSegments || len(req.Segments) > maxSequenceSegments {
+		jsonError(w, fmt.Sprintf("segments must have %d-%d entries", minSequenceSegments, maxSequenceSegments), http.StatusBadRequest)
+		return
+	}
+	segments := make([]*sequenceSegment, 0, len(req.Segments))
+	for i, s := range req.Segments {
+		seg := &sequenceSegment{hint: sanitizePrompt(s.Hint), prompt: sanitizePrompt(s.Prompt)}
+		if len(seg.hint) > maxPromptLength || len(seg.prompt) > maxPromptLength {
+			jsonError(w, fmt.Sprintf("segments[%d] exceeds %d characters", i, maxPromptLength), http.StatusBadRequest)
+			return
+		}
+		segments = append(segments, seg)
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = defaultDuration
+	}
+	if duration < 1 || duration > maxDuration {
+		jsonError(w, fmt.Sprintf("duration must be 1-%d seconds", maxDuration), http.StatusBadRequest)
+		return
+	}
+	if req.Ratio != "" {
+		if _, ok := ratioSizes[req.Ratio]; !ok {
+			jsonError(w, fmt.Sprintf("Unknown ratio: %s", req.Ratio), http.StatusBadRequest)
+			return
+		}
+	}
+	priority := req.Priority
+	if priority == "" {
+		priority = "normal"
+	}
+	if _, ok := priorityRanks[priority]; !ok {
+		jsonError(w, "priority must be one of: low, normal, high", http.StatusBadRequest)
+		return
+	}
+	if req.ProjectID != "" && !projectPattern.MatchString(req.ProjectID) {
+		jsonError(w, fmt.Sprintf("invalid project_id %q", req.ProjectID), http.StatusBadRequest)
+		return
+	}
+	chatModel, err := chatModelFor(req.PromptModel)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	audio := true
+	if req.Audio != nil {
+		audio = *req.Audio
+	}
+
+	reg := snapshot()
+	if rejectDisabledStyles(w, reg, req.Style) {
+		return
+	}
+	targets, err := resolveTargets(reg, []string{req.Style}, req.Model)
+	if err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t := targets[0]
+	// As in handleGenerate: a requested duration must be within the
+	// model's range, the default is fitted into it
+	if req.Duration != 0 {
+		if duration, err = t.model.resolveDuration(duration, durationSeconds); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		duration = min(max(duration, t.model.shortestDuration()), t.model.longestDuration())
+	}
+	t.duration = duration
+	t.ratio = req.Ratio
+	if t.ratio == "" {
+		t.ratio = t.recommendedRatio()
+	}
+
+	var imagePaths []string
+	for _, fn := range req.Filenames {
+		p, err := resolveUpload(fn)
+		if err != nil {
+			jsonError(w, fmt.Sprintf("Image not found: %s", fn), http.StatusBadRequest)
+			return
+		}
+		imagePaths = append(imagePaths, p)
+	}
+	// The first segment starts from the product images; the rest add the
+	// previous segment's closing frame
+	for _, n := range []int{len(imagePaths), len(imagePaths) + 1} {
+		if err := t.style.checkImages(n); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Frames and stitching work on the local copies
+	if !storeVideosLocally {
+		jsonError(w, "Sequences need a local copy of each video; they are unavailable with STORE_VIDEOS_LOCALLY=false", http.StatusBadRequest)
+		return
+	}
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		jsonError(w, "Sequences need ffmpeg to extract frames and stitch segments", http.StatusServiceUnavailable)
+		return
+	}
+
+	seq := &sequence{
+		id:       uuid.New().String()[:12],
+		status:   "processing",
+		product:  req.ProductName,
+		style:    t.styleID(),
+		created:  timestamp(),
+		reqID:    requestID(r.Context()),
+		segments: segments,
+	}
+	plan := sequencePlan{
+		target:     t,
+		product:    req.ProductName,
+		filenames:  req.Filenames,
+		imagePaths: imagePaths,
+		chatModel:  chatModel,
+		audio:      audio,
+		priority:   priority,
+		project:    req.ProjectID,
+	}
+	sequencesMu.Lock()
+	for id, s := range sequences {
+		if !s.finished.IsZero() && time.Since(s.finished) > sequenceTTL {
+			delete(sequences, id)
+		}
+	}
+	sequences[seq.id] = seq
+	sequencesMu.Unlock()
+
+	// The request's context ends with this response; keep its IDs for logs
+	// and the segment jobs
+	ctx := context.WithoutCancel(r.Context())
+	go runSequence(ctx, seq, plan)
+
+	fmt.Printf("Sequence%s: Started %s, %d segments of %ds on %s\n", reqTag(seq.reqID), seq.id, len(segments), duration, t.model.Alias)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sequence_id": seq.id,
+		"group_id":    seq.id,
+		"status":      "processing",
+		"segments":    len(segments),
+		"model":       t.model.Alias,
+		"price":       t.model.costFor(duration) * float64(len(segments)),
+		"status_url":  fmt.Sprintf("http://localhost:8080/api/sequences/%s", seq.id),
+		"message":     "Sequence started",
+	})
+}
+
+// runSequence generates the segments one after another, each starting on
+// the frame the previous one ended on, then stitches them. The first
+// failure stops the sequence; segments already made stay as ordinary jobs.
+func runSequence(ctx context.Context, seq *sequence, plan sequencePlan) {
+	tag := reqTag(seq.reqID)
+	total := len(seq.segments)
+	var previous, clips []string
+	frame := ""
+	for i, seg := range seq.segments {
+		prompt := seg.prompt
+		if prompt == "" {
+			p, err := sequencePrompt(ctx, plan, seg.hint, frame, i+1, total, previous)
+			if err != nil {
+				failSequence(seq, fmt.Sprintf("Segment %d: auto-prompt failed: %v", i+1, err))
+				return
+			}
+			prompt = p
+		}
+
+		job, err := plan.job(ctx, prompt, frame)
+		if err != nil {
+			failSequence(seq, fmt.Sprintf("Segment %d: %v", i+1, err))
+			return
+		}
+		job.GroupID = seq.id
+		submitJob(job)
+		sequencesMu.Lock()
+		seg.prompt, seg.jobID = prompt, job.ID
+		sequencesMu.Unlock()
+		fmt.Printf("Sequence%s: %s segment %d/%d queued as job %s\n", tag, seq.id, i+1, total, job.ID)
+
+		if err := awaitSegment(ctx, job); err != nil {
+			failSequence(seq, fmt.Sprintf("Segment %d: %v", i+1, err))
+			return
+		}
+		videoPath := filepath.Join("videos", job.ID+".mp4")
+		clips = append(clips, videoPath)
+		previous = append(previous, prompt)
+
+		if i < total-1 {
+			if frame, err = closingFrame(ctx, job, videoPath, plan.project); err != nil {
+				failSequence(seq, fmt.Sprintf("Segment %d: could not take its last frame: %v", i+1, err))
+				return
+			}
+			sequencesMu.Lock()
+			seg.frame = frame
+			sequencesMu.Unlock()
+		}
+	}
+
+	sequencesMu.Lock()
+	seq.status = "stitching"
+	sequencesMu.Unlock()
+	videoURL, err := stitchSegments(seq.id, clips)
+	if err != nil {
+		failSequence(seq, fmt.Sprintf("Stitching failed: %v", err))
+		return
+	}
+
+	sequencesMu.Lock()
+	seq.status, seq.videoURL = "completed", videoURL
+	seq.finished = time.Now()
+	sequencesMu.Unlock()
+	fmt.Printf("Sequence%s: %s completed → %s\n", tag, seq.id, videoURL)
+}
+
+func failSequence(seq *sequence, errMsg string) {
+	sequencesMu.Lock()
+	seq.status, seq.err = "failed", errMsg
+	seq.finished = time.Now()
+	sequencesMu.Unlock()
+	fmt.Printf("Sequence%s: %s failed: %s\n", reqTag(seq.reqID), seq.id, errMsg)
+}
+
+// sequencePrompt has the vision model write the direction for one segment
+// from the product images and, after the first, the frame it starts on.
+func sequencePrompt(ctx context.Context, plan sequencePlan, hint, frame string, scene, total int, previous []string) (string, error) {
+	result, _, err := autoPrompt(ctx, autoPromptSpec{
+		chatModel:    plan.chatModel,
+		filenames:    promptFilenames(plan.filenames, frame, autoPromptMaxImages),
+		continuation: frame,
+		bg:           color.White,
+		brief: promptBrief{
+			product:  plan.product,
+			scene:    scene,
+			total:    total,
+			duration: plan.target.duration,
+			previous: previous,
+			style:    plan.target.style,
+			hint:     hint,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	prompt, _ := result["prompt"].(string)
+	return prompt, nil
+}
+
+// job builds one segment's job. frame, when set, is the upload the segment
+// opens on; the product images fill in the rest.
+func (p sequencePlan) job(ctx context.Context, prompt, frame string) (*Job, error) {
+	t := p.target
+	job := &Job{
+		Prompt:         buildPrompt(t.style, prompt, p.product),
+		NegativePrompt: negativePrompt(t.model, t.style, ""),
+		Product:        p.product,
+		Model:          t.model.Name,
+		Style:          t.styleID(),
+		Ratio:          t.ratio,
+		Duration:       t.duration,
+		Fit:            fitNone,
+		Mode:           "image-to-video",
+		Priority:       p.priority,
+		Project:        p.project,
+		RequestID:      requestID(ctx),
+		AppVersion:     appVersion(ctx),
+		imagePaths:     p.imagePaths,
+		model:          t.model,
+		fallback:       t.fallback,
+		fullDur:        t.duration,
+		audio:          p.audio,
+	}
+	if frame != "" {
+		path, err := resolveUpload(frame)
+		if err != nil {
+			return nil, fmt.Errorf("First frame not found: %s", frame)
+		}
+		job.firstFrame = path
+	}
+	return job, nil
+}
+
+// awaitSegment blocks until the job finishes and checks it left a local
+// video to continue from.
+func awaitSegment(ctx context.Context, job *Job) error {
+	for {
+		jobsMu.RLock()
+		status, errMsg := job.Status, job.Error
+		local := strings.HasPrefix(job.VideoURL, "http://localhost:8080/videos/")
+		jobsMu.RUnlock()
+		switch {
+		case status == "failed":
+			return fmt.Errorf("job %s failed: %s", job.ID, errMsg)
+		case status == statusEvicted:
+			return fmt.Errorf("job %s was evicted before it could be used", job.ID)
+		case status == "completed" && !local:
+			return fmt.Errorf("job %s has no local video to continue from", job.ID)
+		case status == "completed":
+			return nil
+		}
+		waitForStatusChange(ctx, job, time.Minute)
+	}
+}
+
+// closingFrame saves the last frame of a segment's video as an upload in
+// the project and returns its filename.
+func closingFrame(ctx context.Context, job *Job, videoPath, project string) (string, error) {
+	duration, err := probeVideoDuration(ctx, videoPath)
+	if err != nil {
+		return "", err
+	}
+	t := max(duration-lastFrameOffset, 0)
+
+	if _, err := uploadDir(project); err != nil {
+		return "", err
+	}
+	filename := uploadName(project, uuid.New().String()+".jpg")
+	if err := extractFrame(ctx, videoPath, t, filepath.Join("uploads", filename)); err != nil {
+		return "", err
+	}
+	jobLogf(job, levelInfo, "Closing frame at %.3fs saved as %s for the next segment", t, filename)
+	return filename, nil
+}
+
+// stitchSegments joins the clips into videos/sequence-<id>.mp4 and returns
+// its URL. The segments share a model and ratio, so their streams are
+// copied rather than re-encoded.
+func stitchSegments(id string, clips []string) (string, error) {
+	name := fmt.Sprintf("sequence-%s.mp4", id)
+	dst := filepath.Join("videos", name)
+
+	list, err := createTemp(dst + ".txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(list.Name())
+	for _, clip := range clips {
+		abs, err := filepath.Abs(clip)
+		if err != nil {
+			list.Close()
+			return "", err
+		}
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	if err := list.Close(); err != nil {
+		return "", err
+	}
+
+	tmp, err := createTemp(dst)
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	args := []string{"-y", "-v", "error", "-f", "concat", "-safe", "0", "-i", list.Name(), "-c", "copy", tmp.Name()}
+	out, err := exec.Command(ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := commitTemp(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://localhost:8080/videos/%s", name), nil
+}
+
+// fields is the sequence as /api/sequences/{id} shows it. Callers hold
+// sequencesMu.
+func (s *sequence) fields() map[string]interface{} {
+	completed := 0
+	segments := make([]map[string]interface{}, 0, len(s.segments))
+	jobsMu.RLock()
+	for i, seg := range s.segments {
+		entry := map[string]interface{}{"segment": i + 1, "status": "pending"}
+		if seg.hint != "" {
+			entry["hint"] = seg.hint
+		}
+		if seg.prompt != "" {
+			entry["prompt"] = seg.prompt
+		}
+		if job, ok := jobs[seg.jobID]; ok {
+			entry["job_id"] = job.ID
+			entry["status"] = job.Status
+			if job.VideoURL != "" {
+				entry["video_url"] = job.VideoURL
+			}
+			if job.Status == "completed" {
+				completed++
+			}
+		}
+		if seg.frame != "" {
+			entry["frame_filename"] = seg.frame
+		}
+		segments = append(segments, entry)
+	}
+	jobsMu.RUnlock()
+
+	fields := map[string]interface{}{
+		"sequence_id": s.id,
+		"status":      s.status,
+		"style":       s.style,
+		"total":       len(s.segments),
+		"completed":   completed,
+		"segments":    segments,
+		"created_at":  s.created,
+	}
+	if s.product != "" {
+		fields["product_name"] = s.product
+	}
+	if s.videoURL != "" {
+		fields["video_url"] = s.videoURL
+	}
+	if s.err != "" {
+		fields["error"] = s.err
+	}
+	if !s.finished.IsZero() {
+		fields["completed_at"] = s.finished.UTC().Format(time.RFC3339)
+	}
+	return fields
+}
+
+// handleSequenceStatus returns a sequence's progress: each segment's job
+// and prompt as it goes, and the stitched video once it's done.
+func handleSequenceStatus(w http.ResponseWriter, r *http.Request) {
+	sequencesMu.Lock()
+	seq, ok := sequences[r.PathValue("id")]
+	if ok && !seq.finished.IsZero() && time.Since(seq.finished) > sequenceTTL {
+		delete(sequences, seq.id)
+		ok = false
+	}
+	var fields map[string]interface{}
+	if ok {
+		fields = seq.fields()
+	}
+	sequencesMu.Unlock()
+	if !ok {
+		jsonError(w, "Sequence not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fields)
+}
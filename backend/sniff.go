@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var sniffImageTypes bool
+
+// imageTypeExts are the image types an upload may really hold, with the
+// extension each is stored under.
+var imageTypeExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+var errNotImage = errors.New("not a JPG, PNG or WEBP image")
+
+// sniffImageType reports the image type data holds going by its magic
+// bytes, or "" when it isn't a JPEG, PNG or WEBP.
+func sniffImageType(data []byte) string {
+	t := http.DetectContentType(data)
+	if _, ok := imageTypeExts[t]; ok {
+		return t
+	}
+	return ""
+}
+
+// imageMediaType is the MIME type to label an image's bytes with when
+// sending them on: what they really hold, or what the extension says with
+// SNIFF_IMAGE_TYPES=false or when the content isn't recognised.
+func imageMediaType(path string, data []byte) string {
+	if sniffImageTypes {
+		if t := sniffImageType(data); t != "" {
+			return t
+		}
+	}
+	return mediaTypeForPath(path)
+}
+
+// checkUploadType sniffs a freshly saved upload. A file that isn't really
+// an image fails with errNotImage; one whose extension doesn't match its
+// content is renamed to the right one. It returns the path the file ends up
+// at. With SNIFF_IMAGE_TYPES=false the extension is trusted as before.
+func checkUploadType(path string) (string, error) {
+	if !sniffImageTypes {
+		return path, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	// DetectContentType looks at no more than the first 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	t := sniffImageType(head[:n])
+	if t == "" {
+		return "", errNotImage
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == imageTypeExts[t] || (ext == ".jpeg" && t == "image/jpeg") {
+		return path, nil
+	}
+	dst := strings.TrimSuffix(path, filepath.Ext(path)) + imageTypeExts[t]
+	if err := os.Rename(path, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// storageDirs are the directories the server writes to.
+func storageDirs() []string {
+	dirs := []string{"uploads", "videos"}
+	if tempDir != "" {
+		dirs = append(dirs, tempDir)
+	}
+	return dirs
+}
+
+// checkWritable writes and removes a small probe file in dir. The probe
+// has data in it so a full disk fails too, not just a read-only mount.
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, tempPrefix+"probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(make([]byte, 4096)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkStorage reports the first storage directory that can't be written.
+func checkStorage() error {
+	for _, dir := range storageDirs() {
+		if err := checkWritable(dir); err != nil {
+			return fmt.Errorf("%s is not writable: %v", dir, err)
+		}
+	}
+	return nil
+}
+
+// isStorageError reports whether err means the disk itself refused the
+// write, as opposed to a bad request or a failing tool.
+func isStorageError(err error) bool {
+	return errors.Is(err, syscall.EROFS) || errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, syscall.EDQUOT) || errors.Is(err, os.ErrPermission)
+}
+
+// saveFailed answers a failed write: 503 when storage is unavailable, so
+// operators and clients can tell it from a bug, otherwise msg with status.
+func saveFailed(w http.ResponseWriter, r *http.Request, err error, msg string, status int) {
+	if isStorageError(err) {
+		fmt.Printf("Storage%s: %v\n", reqTag(requestID(r.Context())), err)
+		jsonError(w, "Storage unavailable: the server can't save files right now", http.StatusServiceUnavailable)
+		return
+	}
+	jsonError(w, msg, status)
+}
+
+// handleReady is the readiness probe: 200 while every storage directory
+// takes writes, 503 with the failing ones otherwise.
+func handleReady(w http.ResponseWriter, r *http.Request) {
+	storage := map[string]string{}
+	ready := true
+	for _, dir := range storageDirs() {
+		storage[dir] = "ok"
+		if err := checkWritable(dir); err != nil {
+			storage[dir] = err.Error()
+			ready = false
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "storage unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
+		"storage": storage,
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobRecord is the on-disk form of a Job, including the fields that are
+// not part of the API response.
+type jobRecord struct {
+	*Job
+	ImagePaths []string `json:"image_paths,omitempty"`
+	VideoPath  string   `json:"video_path,omitempty"`
+	ThumbPath  string   `json:"thumb_path,omitempty"`
+	TaskUUID   string   `json:"task_uuid,omitempty"`
+	FirstFrame string   `json:"first_frame,omitempty"`
+	LastFrame  string   `json:"last_frame,omitempty"`
+	MaskPath   string   `json:"mask_path,omitempty"`
+	Narration  string   `json:"narration,omitempty"`
+	Fallback   string   `json:"fallback_alias,omitempty"`
+	FullDur    int      `json:"full_duration,omitempty"`
+	ModelAlias string   `json:"model_alias,omitempty"`
+	Audio      bool     `json:"audio"`
+
+	// Callback credentials are why the store is only readable by the owner
+	CallbackURL  string `json:"callback_url,omitempty"`
+	CallbackAuth string `json:"callback_auth,omitempty"`
+}
+
+// saveMu serializes writers so snapshots land in order.
+var saveMu sync.Mutex
+
+// saveJobs snapshots every job to jobsFile. It writes a temp file and
+// renames it so a crash never leaves a half-written store. Callers must not
+// hold jobsMu.
+func saveJobs() {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	jobsMu.RLock()
+	records := make([]jobRecord, 0, len(jobs))
+	for _, j := range jobs {
+		rec := jobRecord{
+			Job:        j,
+			ImagePaths: j.imagePaths,
+			VideoPath:  j.videoPath,
+			ThumbPath:  j.thumbPath,
+			TaskUUID:   j.taskUUID,
+			FirstFrame: j.firstFrame,
+			LastFrame:  j.lastFrame,
+			MaskPath:   j.maskPath,
+			Narration:  j.narration,
+			FullDur:    j.fullDur,
+			Audio:      j.audio,
+		}
+		if j.model != nil {
+			rec.ModelAlias = j.model.Alias
+		}
+		if j.fallback != nil {
+			rec.Fallback = j.fallback.Alias
+		}
+		rec.CallbackURL, rec.CallbackAuth = j.callbackURL, j.callbackAuth
+		records = append(records, rec)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	jobsMu.RUnlock()
+	if err != nil {
+		fmt.Printf("Store: Encode failed: %v\n", err)
+		return
+	}
+
+	tmp := jobsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		fmt.Printf("Store: Write failed: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, jobsFile); err != nil {
+		fmt.Printf("Store: Rename failed: %v\n", err)
+	}
+}
+
+// loadJobs restores jobs saved by a previous run. Jobs that were still
+// queued go back on the queue; jobs that were mid-generation resume polling
+// their provider task, or are marked failed if they never got one or are
+// older than resumeMaxAge.
+func loadJobs() error {
+	data, err := os.ReadFile(jobsFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var records []jobRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("parse %s: %v", jobsFile, err)
+	}
+
+	var requeue, resume []*Job
+	jobsMu.Lock()
+	for _, rec := range records {
+		if rec.Job == nil || rec.ID == "" {
+			continue
+		}
+		j := rec.Job
+		j.imagePaths = rec.ImagePaths
+		j.videoPath = rec.VideoPath
+		j.thumbPath = rec.ThumbPath
+		j.taskUUID = rec.TaskUUID
+		j.firstFrame = rec.FirstFrame
+		j.lastFrame = rec.LastFrame
+		j.maskPath = rec.MaskPath
+		j.callbackURL = rec.CallbackURL
+		j.callbackAuth = rec.CallbackAuth
+		j.narration = rec.Narration
+		j.fullDur = rec.FullDur
+		j.audio = rec.Audio
+		// Older records stored CreatedAt in server-local time
+		if t, err := time.Parse(time.RFC3339, j.CreatedAt); err == nil {
+			j.CreatedAt = t.UTC().Format(time.RFC3339)
+		}
+		if t, err := time.Parse(time.RFC3339, j.StartedAt); err == nil {
+			j.started = t
+		}
+		if m, ok := lookupModel(rec.ModelAlias); ok {
+			j.model = m
+		}
+		if m, ok := lookupModel(rec.Fallback); ok && rec.Fallback != "" {
+			j.fallback = m
+		}
+
+		switch {
+		case j.Status == "queued" && j.InlineImages > 0:
+			// Inline images lived only in the previous process's memory
+			j.Status = "failed"
+			j.Error = "Interrupted by server restart; inline images are not kept"
+		case j.Status == "queued" && j.model != nil:
+			requeue = append(requeue, j)
+		case j.Status == "processing" && resumable(j):
+			resume = append(resume, j)
+		case j.Status == "queued" || j.Status == "processing":
+			j.Status = "failed"
+			j.Error = "Interrupted by server restart"
+		}
+		if j.PollPaused {
+			if j.Status == "processing" {
+				// Stays paused until someone resumes it
+				j.pollResumed = make(chan struct{})
+			} else {
+				j.PollPaused = false
+			}
+		}
+		newJobContext(j)
+		jobs[j.ID] = j
+		indexGroup(j)
+	}
+	sortGroups()
+	jobsMu.Unlock()
+
+	for _, j := range requeue {
+		queue.push(j)
+	}
+	for _, j := range resume {
+		jobLogf(j, levelInfo, "Resuming poll for task %s", j.taskUUID)
+		go waitForResult(j, j.taskUUID)
+	}
+	fmt.Printf("Store: Loaded %d job(s), requeued %d, resumed %d\n", len(records), len(requeue), len(resume))
+	return nil
+}
+
+// resumable reports whether a job that was mid-generation at shutdown can
+// go back to polling its provider task: it must have been submitted, and
+// not so long ago that the provider has likely dropped the result.
+func resumable(j *Job) bool {
+	if j.taskUUID == "" || j.model == nil {
+		return false
+	}
+	return !j.started.IsZero() && time.Since(j.started) <= resumeMaxAge
+}
+
+// sweepUploads deletes files in uploads/ that no known job references and
+// that haven't been modified within the grace period. The grace period also
+// protects files that are still being written.
+func sweepUploads(grace time.Duration) {
+	referenced := make(map[string]bool)
+	jobsMu.RLock()
+	for _, j := range jobs {
+		for _, p := range j.imagePaths {
+			referenced[filepath.Clean(p)] = true
+		}
+		// Background-removed copies and kept originals live as long as
+		// their source
+		for _, p := range jobImages(j) {
+			referenced[cutoutPath(p)] = true
+			referenced[blurPath(p)] = true
+			for _, ext := range originalExts {
+				referenced[originalPath(p, ext)] = true
+			}
+		}
+		for _, p := range []string{j.videoPath, j.thumbPath, j.firstFrame, j.lastFrame, j.maskPath} {
+			if p != "" {
+				referenced[filepath.Clean(p)] = true
+			}
+		}
+	}
+	jobsMu.RUnlock()
+
+	cutoff := time.Now().Add(-grace)
+	removed := sweepDir("uploads", referenced, cutoff)
+	if removed > 0 {
+		fmt.Printf("Sweep: Removed %d orphaned upload(s)\n", removed)
+	}
+}
+
+// sweepDir removes unreferenced files in dir older than cutoff, descending
+// into project directories, and returns how many it removed.
+func sweepDir(dir string, referenced map[string]bool, cutoff time.Time) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			// Staging dirs left behind by an interrupted multi-upload
+			if info, err := e.Info(); err == nil && strings.HasPrefix(e.Name(), ".tmp-") && info.ModTime().Before(cutoff) {
+				os.RemoveAll(p)
+			} else if dir == "uploads" && projectPattern.MatchString(e.Name()) {
+				removed += sweepDir(p, referenced, cutoff)
+			}
+			continue
+		}
+		if referenced[p] {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(p); err == nil {
+			removed++
+		}
+	}
+	return removed
+}
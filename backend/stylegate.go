@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// styleEnabled reports whether ENABLED_STYLES lets requests use a style.
+// An empty allowlist enables every style.
+func styleEnabled(id string) bool {
+	return len(enabledStyles) == 0 || slices.Contains(enabledStyles, id)
+}
+
+// rejectDisabledStyles answers 403 for the first style in ids that exists
+// but is not enabled, and reports whether it did. Unknown styles are left
+// to the caller's usual 400.
+func rejectDisabledStyles(w http.ResponseWriter, reg *registry, ids ...string) bool {
+	for _, id := range ids {
+		if _, ok := reg.style(id); ok && !styleEnabled(id) {
+			jsonError(w, fmt.Sprintf("Style %s is not enabled on this server", id), http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+// enabledPresets drops presets whose style is disabled, as generate would
+// refuse them.
+func enabledPresets(presets []*PresetConfig) []*PresetConfig {
+	out := make([]*PresetConfig, 0, len(presets))
+	for _, p := range presets {
+		if p.Style == "" || styleEnabled(p.Style) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
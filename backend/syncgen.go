@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// jobFinished reports whether a job in status will change no further.
+func jobFinished(status string) bool {
+	return status == "completed" || status == "failed" || status == statusEvicted
+}
+
+// generateWait parses ?wait on /api/generate. "true" waits up to
+// MAX_GENERATE_WAIT and a number of seconds waits that long, within the same
+// cap. Zero means the usual queued response.
+func generateWait(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("wait")
+	switch v {
+	case "", "false":
+		return 0, nil
+	case "true":
+		return maxGenerateWait, nil
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("wait must be true or a number of seconds")
+	}
+	return min(time.Duration(secs)*time.Second, maxGenerateWait), nil
+}
+
+// waitForJob blocks until the job finishes or timeout passes. Like
+// waitForStatusChange it reports false when the client went away.
+func waitForJob(ctx context.Context, job *Job, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return true
+		}
+		if !waitForStatusChange(ctx, job, remaining) {
+			return false
+		}
+		jobsMu.RLock()
+		done := jobFinished(job.Status)
+		jobsMu.RUnlock()
+		if done {
+			return true
+		}
+	}
+}
+
+// writeSyncResult answers a waiting generate with the job's status body:
+// 200 once the video is ready, 502 if the job failed and 504 with the job
+// ID to keep polling if it is still running.
+func writeSyncResult(w http.ResponseWriter, job *Job) {
+	jobsMu.RLock()
+	resp := statusFields(job)
+	resp["job_id"] = job.ID
+	status := job.Status
+	jobsMu.RUnlock()
+
+	code := http.StatusOK
+	switch {
+	case status == "failed":
+		code = http.StatusBadGateway
+	case !jobFinished(status):
+		code = http.StatusGatewayTimeout
+		resp["error"] = "Timed out waiting for the video; keep polling /api/status/" + job.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
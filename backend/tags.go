@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxJobTags    = 20
+	maxTagLength  = 40
+	maxNoteLength = 1000
+)
+
+// cleanTags sanitizes tags and lowercases them so ?tag= matches regardless
+// of how they were typed. Blank and repeated tags are dropped.
+func cleanTags(tags []string) ([]string, error) {
+	var out []string
+	for _, t := range tags {
+		t = strings.ToLower(sanitizePrompt(t))
+		if t == "" || slices.Contains(out, t) {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagLength {
+			return nil, fmt.Errorf("tag %q exceeds %d characters", t, maxTagLength)
+		}
+		out = append(out, t)
+	}
+	if len(out) > maxJobTags {
+		return nil, fmt.Errorf("a job can have at most %d tags", maxJobTags)
+	}
+	return out, nil
+}
+
+// cleanNote sanitizes a job note, keeping its line breaks.
+func cleanNote(note string) (string, error) {
+	lines := strings.Split(note, "\n")
+	for i, l := range lines {
+		lines[i] = sanitizePrompt(l)
+	}
+	note = strings.TrimSpace(strings.Join(lines, "\n"))
+	if utf8.RuneCountInString(note) > maxNoteLength {
+		return "", fmt.Errorf("note exceeds %d characters", maxNoteLength)
+	}
+	return note, nil
+}
+
+// hasTags reports whether the job carries every one of tags.
+func (j *Job) hasTags(tags []string) bool {
+	for _, t := range tags {
+		if !slices.Contains(j.Tags, strings.ToLower(t)) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleUpdateJob changes a job's tags and note. Fields left out of the
+// body are kept; "tags": [] clears them.
+func handleUpdateJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tags *[]string `json:"tags"`
+		Note *string   `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	var tags []string
+	var note string
+	var err error
+	if req.Tags != nil {
+		if tags, err = cleanTags(*req.Tags); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Note != nil {
+		if note, err = cleanNote(*req.Note); err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobsMu.Lock()
+	job, ok := jobs[r.PathValue("id")]
+	if !ok {
+		jobsMu.Unlock()
+		jsonError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if req.Tags != nil {
+		job.Tags = tags
+	}
+	if req.Note != nil {
+		job.Note = note
+	}
+	resp := map[string]interface{}{
+		"id":   job.ID,
+		"tags": job.Tags,
+		"note": job.Note,
+	}
+	jobsMu.Unlock()
+	saveJobs()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
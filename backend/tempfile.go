@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Temp files are named ".tmp-*" so sweeps and the startup cleanup can spot
+// them, and end in dst's own name so tools like ffmpeg still see the right
+// extension.
+const tempPrefix = ".tmp-"
+
+// createTemp opens a temp file that commitTemp later moves to dst. It lives
+// in TEMP_DIR, or next to dst when that's unset so the final rename stays on
+// one filesystem.
+func createTemp(dst string) (*os.File, error) {
+	dir := tempDir
+	if dir == "" {
+		dir = filepath.Dir(dst)
+	}
+	f, err := os.CreateTemp(dir, tempPrefix+"*-"+filepath.Base(dst))
+	if err != nil {
+		return nil, err
+	}
+	// CreateTemp uses 0600; match what os.Create would have made
+	f.Chmod(0644)
+	return f, nil
+}
+
+// commitTemp renames a closed temp file to dst, so readers only ever see
+// the complete file. If TEMP_DIR is on another filesystem the file is first
+// copied next to dst, keeping the last step a rename. tmp is gone either
+// way.
+func commitTemp(tmp, dst string) error {
+	err := os.Rename(tmp, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		os.Remove(tmp)
+		return err
+	}
+	defer os.Remove(tmp)
+
+	src, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	near, err := os.CreateTemp(filepath.Dir(dst), tempPrefix+"*-"+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	if err := near.Chmod(0644); err != nil {
+		near.Close()
+		os.Remove(near.Name())
+		return err
+	}
+	if _, err := io.Copy(near, src); err != nil {
+		near.Close()
+		os.Remove(near.Name())
+		return err
+	}
+	if err := near.Close(); err != nil {
+		os.Remove(near.Name())
+		return err
+	}
+	if err := os.Rename(near.Name(), dst); err != nil {
+		os.Remove(near.Name())
+		return err
+	}
+	return nil
+}
+
+// writeFileAtomic writes dst through a temp file, committing it only when
+// write succeeds.
+func writeFileAtomic(dst string, write func(io.Writer) error) error {
+	f, err := createTemp(dst)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return commitTemp(f.Name(), dst)
+}
+
+// removeStaleTemps deletes temp files an earlier run left behind when it
+// stopped mid-write, and staging directories in TEMP_DIR. Staging
+// directories under uploads/ are left to the upload sweep.
+func removeStaleTemps() {
+	dirs := []string{"videos", "uploads"}
+	if tempDir != "" {
+		dirs = append(dirs, tempDir)
+	}
+	removed := 0
+	for _, dir := range dirs {
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if !strings.HasPrefix(e.Name(), tempPrefix) || (e.IsDir() && dir != tempDir) {
+				continue
+			}
+			if os.RemoveAll(filepath.Join(dir, e.Name())) == nil {
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		fmt.Printf("Removed %d leftover temp file(s)\n", removed)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// PromptTemplate is a reusable prompt with {placeholder} variables that
+// /api/generate fills in from template_vars.
+type PromptTemplate struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Text      string   `json:"text"`
+	Variables []string `json:"variables"`
+	CreatedAt string   `json:"created_at"`
+}
+
+var placeholderPattern = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var (
+	templates   = make(map[string]*PromptTemplate)
+	templatesMu sync.RWMutex
+)
+
+// templateVariables lists the distinct placeholders in text, in order of
+// first use.
+func templateVariables(text string) []string {
+	vars := []string{}
+	seen := make(map[string]bool)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			vars = append(vars, m[1])
+		}
+	}
+	return vars
+}
+
+// render fills every placeholder from vars. It fails listing the
+// placeholders that have no value.
+func (t *PromptTemplate) render(vars map[string]string) (string, error) {
+	var missing []string
+	for _, name := range t.Variables {
+		if strings.TrimSpace(vars[name]) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s is missing values for: %s", t.ID, strings.Join(missing, ", "))
+	}
+	return placeholderPattern.ReplaceAllStringFunc(t.Text, func(m string) string {
+		return strings.TrimSpace(vars[m[1:len(m)-1]])
+	}), nil
+}
+
+func lookupTemplate(id string) (*PromptTemplate, bool) {
+	templatesMu.RLock()
+	defer templatesMu.RUnlock()
+	t, ok := templates[id]
+	return t, ok
+}
+
+// loadTemplates restores templates saved by a previous run.
+func loadTemplates() error {
+	data, err := os.ReadFile(templatesFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var list []*PromptTemplate
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("parse %s: %v", templatesFile, err)
+	}
+
+	templatesMu.Lock()
+	for _, t := range list {
+		t.Variables = templateVariables(t.Text)
+		templates[t.ID] = t
+	}
+	templatesMu.Unlock()
+	return nil
+}
+
+// templatesSaveMu serializes writers so two saves don't share the temp
+// file and snapshots land in order.
+var templatesSaveMu sync.Mutex
+
+// saveTemplates writes every template to templatesFile via a temp file and
+// rename. Callers must not hold templatesMu.
+func saveTemplates() {
+	templatesSaveMu.Lock()
+	defer templatesSaveMu.Unlock()
+
+	templatesMu.RLock()
+	data, err := json.MarshalIndent(sortedTemplates(), "", "  ")
+	templatesMu.RUnlock()
+	if err != nil {
+		fmt.Printf("Templates: Encode failed: %v\n", err)
+		return
+	}
+
+	tmp := templatesFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		fmt.Printf("Templates: Write failed: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, templatesFile); err != nil {
+		fmt.Printf("Templates: Rename failed: %v\n", err)
+	}
+}
+
+// sortedTemplates returns templates by name. Caller holds templatesMu.
+func sortedTemplates() []*PromptTemplate {
+	list := make([]*PromptTemplate, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+func handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	text := sanitizePrompt(req.Text)
+	if req.Name == "" || text == "" {
+		jsonError(w, "name and text are required", http.StatusBadRequest)
+		return
+	}
+	if len(text) > maxPromptLength {
+		jsonError(w, fmt.Sprintf("text exceeds %d characters", maxPromptLength), http.StatusBadRequest)
+		return
+	}
+
+	t := &PromptTemplate{
+		ID:        uuid.New().String()[:12],
+		Name:      req.Name,
+		Text:      text,
+		Variables: templateVariables(text),
+		CreatedAt: timestamp(),
+	}
+	templatesMu.Lock()
+	templates[t.ID] = t
+	templatesMu.Unlock()
+	saveTemplates()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+func handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templatesMu.RLock()
+	list := sortedTemplates()
+	templatesMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"templates": list})
+}
+
+func handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, ok := lookupTemplate(r.PathValue("id"))
+	if !ok {
+		jsonError(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+func handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	templatesMu.Lock()
+	_, ok := templates[id]
+	delete(templates, id)
+	templatesMu.Unlock()
+	if !ok {
+		jsonError(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	saveTemplates()
+	w.WriteHeader(http.StatusNoContent)
+}
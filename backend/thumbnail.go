@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	thumbnailFormat  string
+	thumbnailMaxEdge int
+)
+
+// thumbnailFormats are the supported THUMBNAIL_FORMAT values: the file
+// extension and the ffmpeg options to encode it with.
+var thumbnailFormats = map[string]struct {
+	ext  string
+	opts []string
+}{
+	"jpeg": {".jpg", []string{"-q:v", "3"}},
+	"png":  {".png", nil},
+	"webp": {".webp", []string{"-c:v", "libwebp", "-quality", "80"}},
+}
+
+// checkThumbnailConfig validates THUMBNAIL_FORMAT and THUMBNAIL_MAX_EDGE.
+func checkThumbnailConfig() error {
+	if _, ok := thumbnailFormats[thumbnailFormat]; !ok {
+		return fmt.Errorf("THUMBNAIL_FORMAT must be jpeg, png or webp")
+	}
+	if thumbnailMaxEdge < 0 {
+		return fmt.Errorf("THUMBNAIL_MAX_EDGE must be 0 (full size) or more")
+	}
+	return nil
+}
+
+// isThumbnailFile reports whether p is a thumbnail makeThumbnail wrote for
+// the job. They're kept when the video is evicted, so galleries still show
+// something.
+func isThumbnailFile(j *Job, p string) bool {
+	return strings.HasPrefix(filepath.Base(p), j.ID+".thumb.")
+}
+
+// makeThumbnail saves the middle frame of the job's downloaded video as
+// videos/<id>.thumb.<ext>, in THUMBNAIL_FORMAT and shrunk to fit
+// THUMBNAIL_MAX_EDGE, and returns its URL and size. Without ffmpeg it
+// returns "" and no error.
+func makeThumbnail(job *Job, videoPath string) (string, int, int, error) {
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		jobLogf(job, levelWarn, "Skipping thumbnail, ffmpeg not found")
+		return "", 0, 0, nil
+	}
+	format := thumbnailFormats[thumbnailFormat]
+
+	var t float64
+	if d, err := probeVideoDuration(job.ctx, videoPath); err == nil {
+		t = d / 2
+	}
+	opts := format.opts
+	if thumbnailMaxEdge > 0 {
+		edge := strconv.Itoa(thumbnailMaxEdge)
+		// Fits the box, keeping the aspect ratio and never upscaling
+		scale := fmt.Sprintf("scale=w='min(iw,%s)':h='min(ih,%s)':force_original_aspect_ratio=decrease", edge, edge)
+		opts = append([]string{"-vf", scale}, opts...)
+	}
+	if len(opts) == 0 {
+		// extractFrame's default options are for JPEG
+		opts = []string{"-compression_level", "6"}
+	}
+
+	name := job.ID + ".thumb" + format.ext
+	dst := filepath.Join("videos", name)
+	if err := extractFrame(job.ctx, videoPath, t, dst, opts...); err != nil {
+		return "", 0, 0, err
+	}
+
+	f, err := os.Open(dst)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("read thumbnail size: %v", err)
+	}
+	return fmt.Sprintf("http://localhost:8080/videos/%s", name), cfg.Width, cfg.Height, nil
+}
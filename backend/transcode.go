@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputFormat is a delivery encoding a generate request can ask for on top
+// of the provider's mp4.
+type outputFormat struct {
+	codec     string // file name part, <id>.<codec>.<container>
+	container string
+	args      []string // ffmpeg encoding options
+}
+
+// outputFormats are the supported values of output_format.
+var outputFormats = map[string]outputFormat{
+	"mp4-h264": {"h264", "mp4", []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac", "-movflags", "+faststart"}},
+	"mp4-h265": {"h265", "mp4", []string{"-c:v", "libx265", "-tag:v", "hvc1", "-pix_fmt", "yuv420p", "-c:a", "aac", "-movflags", "+faststart"}},
+	"mov-h264": {"h264", "mov", []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac"}},
+	"webm-vp9": {"vp9", "webm", []string{"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "32", "-c:a", "libopus"}},
+}
+
+// checkOutputFormat validates output_format on a generate request.
+func checkOutputFormat(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := outputFormats[name]; !ok {
+		names := make([]string, 0, len(outputFormats))
+		for n := range outputFormats {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("output_format must be one of: %s", strings.Join(names, ", "))
+	}
+	if !storeVideosLocally {
+		return fmt.Errorf("output_format needs a local copy of the video; it is unavailable with STORE_VIDEOS_LOCALLY=false")
+	}
+	return nil
+}
+
+// transcodeVideo writes a copy of the downloaded video in the job's
+// output_format next to the original, which is left untouched, and returns
+// its URL. Without ffmpeg it returns "" and no error, and the job completes
+// with the original only.
+func transcodeVideo(job *Job, videoPath string) (string, error) {
+	f, ok := outputFormats[job.OutputFormat]
+	if !ok {
+		return "", fmt.Errorf("unknown output format %q", job.OutputFormat)
+	}
+	if _, err := exec.LookPath(ffmpegPath); err != nil {
+		jobLogf(job, levelWarn, "Skipping %s output, ffmpeg not found", job.OutputFormat)
+		return "", nil
+	}
+
+	name := fmt.Sprintf("%s.%s.%s", job.ID, f.codec, f.container)
+	dst := filepath.Join("videos", name)
+	tmp, err := createTemp(dst)
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+
+	args := append([]string{"-y", "-v", "error", "-i", videoPath}, f.args...)
+	args = append(args, tmp.Name())
+	out, err := exec.CommandContext(job.ctx, ffmpegPath, args...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := commitTemp(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("http://localhost:8080/videos/%s", name), nil
+}
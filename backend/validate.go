@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Pre-flight thresholds for product images.
+const (
+	minImageSide   = 512  // shorter side below this comes out soft
+	maxImageSide   = 4096 // providers downscale anything bigger anyway
+	maxImageAspect = 2.5  // longer/shorter side beyond this crops badly
+	busyEdgeLevel  = 14.0 // mean luminance step along the border
+	cutOffShare    = 0.35 // share of an edge that differs from the background
+)
+
+type imageReport struct {
+	Filename     string   `json:"filename"`
+	Width        int      `json:"width"`
+	Height       int      `json:"height"`
+	AspectRatio  float64  `json:"aspect_ratio"`
+	ClosestRatio string   `json:"closest_ratio"`
+	TooSmall     bool     `json:"too_small"`
+	TooLarge     bool     `json:"too_large"`
+	BusyBack     bool     `json:"busy_background"`
+	CutOffEdges  []string `json:"cut_off_edges,omitempty"`
+	Score        int      `json:"score"`
+	Warnings     []string `json:"warnings"`
+	Assessment   string   `json:"assessment,omitempty"`
+}
+
+// handleValidateImage reports whether an uploaded image is a good input
+// before credits are spent on it. With "use_model" the vision model adds a
+// one-line assessment.
+func handleValidateImage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filename string `json:"filename"`
+		Ratio    string `json:"ratio"`
+		UseModel bool   `json:"use_model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err)
+		return
+	}
+
+	p, err := resolveUpload(req.Filename)
+	if err != nil {
+		jsonError(w, fmt.Sprintf("Image not found: %s", req.Filename), http.StatusBadRequest)
+		return
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		jsonError(w, "Could not read image", http.StatusInternalServerError)
+		return
+	}
+	// The header alone tells how much memory decoding would take
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		jsonError(w, "File is not a valid JPG, PNG or WEBP image", http.StatusBadRequest)
+		return
+	}
+	if err := checkPixels(cfg); err != nil {
+		jsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		jsonError(w, "File is not a valid JPG, PNG or WEBP image", http.StatusBadRequest)
+		return
+	}
+
+	report := analyzeImage(img)
+	report.Filename = req.Filename
+	if _, ok := ratioSizes[req.Ratio]; ok && req.Ratio != report.ClosestRatio {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Image is closer to %s than the requested %s; consider fit=pad or fit=crop", report.ClosestRatio, req.Ratio))
+		report.Score -= 10
+	}
+	if report.Score < 0 {
+		report.Score = 0
+	}
+
+	if req.UseModel {
+		b64 := fmt.Sprintf("data:%s;base64,%s", imageMediaType(p, data), base64.StdEncoding.EncodeToString(data))
+		assessment, _, err := askModelRunner(modelRunnerModel, []map[string]interface{}{
+			{"type": "text", "text": "Is this photo a good input for a product video ad? " +
+				"Mention lighting, whether the product is fully in frame, and background clutter. One or two sentences."},
+			{"type": "image_url", "image_url": map[string]string{"url": b64}},
+		})
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Vision check unavailable: %v", err))
+		} else {
+			report.Assessment = assessment
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// analyzeImage runs the cheap pixel heuristics and scores the image out of
+// 100.
+func analyzeImage(img image.Image) imageReport {
+	b := img.Bounds()
+	rep := imageReport{
+		Width:    b.Dx(),
+		Height:   b.Dy(),
+		Score:    100,
+		Warnings: []string{},
+	}
+	rep.AspectRatio = math.Round(float64(rep.Width)/float64(rep.Height)*100) / 100
+	rep.ClosestRatio = closestRatio(rep.Width, rep.Height)
+
+	short, long := min(rep.Width, rep.Height), max(rep.Width, rep.Height)
+	if short < minImageSide {
+		rep.TooSmall = true
+		rep.Score -= 40
+		rep.Warnings = append(rep.Warnings, fmt.Sprintf("Low resolution: shorter side is %dpx, aim for at least %dpx", short, minImageSide))
+	}
+	if long > maxImageSide {
+		rep.TooLarge = true
+		rep.Score -= 5
+		rep.Warnings = append(rep.Warnings, fmt.Sprintf("Very large image (%dpx); it will be downscaled", long))
+	}
+	if float64(long)/float64(short) > maxImageAspect {
+		rep.Score -= 10
+		rep.Warnings = append(rep.Warnings, "Extreme aspect ratio; most of the image will be cropped or padded")
+	}
+
+	if borderBusyness(img) > busyEdgeLevel {
+		rep.BusyBack = true
+		rep.Score -= 25
+		rep.Warnings = append(rep.Warnings, "Busy background; a plain backdrop keeps the focus on the product")
+	} else if edges := cutOffEdges(img); len(edges) > 0 {
+		// Only meaningful against a plain background
+		rep.CutOffEdges = edges
+		rep.Score -= 20
+		rep.Warnings = append(rep.Warnings, fmt.Sprintf("Product may be cut off at the %s edge", strings.Join(edges, " and ")))
+	}
+	return rep
+}
+
+// closestRatio returns the supported output ratio nearest to w:h.
+func closestRatio(w, h int) string {
+	got := float64(w) / float64(h)
+	ratios := make([]string, 0, len(ratioSizes))
+	for r := range ratioSizes {
+		ratios = append(ratios, r)
+	}
+	sort.Strings(ratios)
+
+	best, bestDiff := "", math.Inf(1)
+	for _, r := range ratios {
+		size := ratioSizes[r]
+		diff := math.Abs(math.Log(got / (float64(size[0]) / float64(size[1]))))
+		if diff < bestDiff {
+			best, bestDiff = r, diff
+		}
+	}
+	return best
+}
+
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+}
+
+// borderBusyness is the mean luminance change between neighbouring pixels
+// in the outer tenth of the image, where a product shot's backdrop is.
+func borderBusyness(img image.Image) float64 {
+	b := img.Bounds()
+	bandX, bandY := max(b.Dx()/10, 1), max(b.Dy()/10, 1)
+	step := max(min(b.Dx(), b.Dy())/200, 1)
+
+	var total float64
+	var n int
+	for y := b.Min.Y; y < b.Max.Y-step; y += step {
+		for x := b.Min.X; x < b.Max.X-step; x += step {
+			inBand := x < b.Min.X+bandX || x >= b.Max.X-bandX || y < b.Min.Y+bandY || y >= b.Max.Y-bandY
+			if !inBand {
+				continue
+			}
+			l := luminance(img.At(x, y))
+			total += math.Abs(l-luminance(img.At(x+step, y))) + math.Abs(l-luminance(img.At(x, y+step)))
+			n += 2
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return total / float64(n)
+}
+
+// cutOffEdges lists the sides where a large share of the outermost pixels
+// differ from the backdrop, meaning the product runs off the frame.
+func cutOffEdges(img image.Image) []string {
+	b := img.Bounds()
+	bg := luminance(img.At(b.Min.X, b.Min.Y))
+	for _, p := range []image.Point{{b.Max.X - 1, b.Min.Y}, {b.Min.X, b.Max.Y - 1}, {b.Max.X - 1, b.Max.Y - 1}} {
+		bg += luminance(img.At(p.X, p.Y))
+	}
+	bg /= 4
+
+	share := func(n int, at func(i int) color.Color) float64 {
+		step := max(n/200, 1)
+		var off, total int
+		for i := 0; i < n; i += step {
+			if math.Abs(luminance(at(i))-bg) > 40 {
+				off++
+			}
+			total++
+		}
+		return float64(off) / float64(total)
+	}
+
+	var edges []string
+	sides := []struct {
+		name string
+		n    int
+		at   func(i int) color.Color
+	}{
+		{"top", b.Dx(), func(i int) color.Color { return img.At(b.Min.X+i, b.Min.Y) }},
+		{"bottom", b.Dx(), func(i int) color.Color { return img.At(b.Min.X+i, b.Max.Y-1) }},
+		{"left", b.Dy(), func(i int) color.Color { return img.At(b.Min.X, b.Min.Y+i) }},
+		{"right", b.Dy(), func(i int) color.Color { return img.At(b.Max.X-1, b.Min.Y+i) }},
+	}
+	for _, s := range sides {
+		if share(s.n, s.at) > cutOffShare {
+			edges = append(edges, s.name)
+		}
+	}
+	return edges
+}
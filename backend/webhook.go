@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	maxCallbackAuthLength = 1024
+	callbackAttempts      = 3
+)
+
+var callbackAllowPrivate bool
+
+// callbackClient refuses to connect to internal addresses, checking the IP
+// it actually dials so a hostname that re-resolves after checkCallback
+// can't reach them either.
+var callbackClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !callbackIPAllowed(ip) {
+					return fmt.Errorf("callback to internal address %s refused", host)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+}
+
+// callbackIPAllowed reports whether callbacks may go to ip: anything public,
+// or any address at all with CALLBACK_ALLOW_PRIVATE=true.
+func callbackIPAllowed(ip net.IP) bool {
+	if callbackAllowPrivate {
+		return true
+	}
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// checkCallback validates a generate request's callback_url and the
+// Authorization value to send with it. The value stays on the job and is
+// never returned by the API.
+func checkCallback(rawURL, auth string) error {
+	if rawURL == "" {
+		if auth != "" {
+			return fmt.Errorf("callback_auth_header needs a callback_url")
+		}
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("callback_url must be an absolute http(s) URL")
+	}
+	// Loopback, private and link-local targets would let any client reach
+	// the server's own network, cloud metadata included
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("callback_url host %s does not resolve", u.Hostname())
+	}
+	for _, a := range addrs {
+		if !callbackIPAllowed(a.IP) {
+			return fmt.Errorf("callback_url must not point to a loopback, private or link-local address")
+		}
+	}
+	if len(auth) > maxCallbackAuthLength {
+		return fmt.Errorf("callback_auth_header exceeds %d characters", maxCallbackAuthLength)
+	}
+	// Printable ASCII only, so it can't smuggle extra header lines
+	for i := 0; i < len(auth); i++ {
+		if c := auth[i]; c < 0x20 || c > 0x7e {
+			return fmt.Errorf("callback_auth_header may only contain printable ASCII")
+		}
+	}
+	return nil
+}
+
+// sendCallback POSTs the job's status to its callback_url once it has
+// finished, with its callback_auth_header as the Authorization header.
+func sendCallback(job *Job, event string) {
+	jobsMu.RLock()
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event": event,
+		"at":    timestamp(),
+		"job":   statusFields(job),
+	})
+	target, auth := job.callbackURL, job.callbackAuth
+	jobsMu.RUnlock()
+
+	deliverCallback(target, auth, job.RequestID, event, payload, func(level, format string, args ...interface{}) {
+		jobLogf(job, level, format, args...)
+	})
+}
+
+// deliverCallback POSTs payload to target, retrying failed deliveries with
+// a growing delay before giving up, and reports each attempt through logf.
+func deliverCallback(target, auth, reqID, event string, payload []byte, logf func(level, format string, args ...interface{})) {
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		req, _ := http.NewRequest("POST", target, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if reqID != "" {
+			req.Header.Set("X-Request-ID", reqID)
+		}
+
+		resp, err := callbackClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				logf(levelInfo, "Callback delivered (%s)", event)
+				return
+			}
+			err = fmt.Errorf("receiver returned %s", resp.Status)
+		}
+		logf(levelWarn, "Callback attempt %d/%d failed: %v", attempt, callbackAttempts, err)
+		if attempt < callbackAttempts {
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+	}
+}